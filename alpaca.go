@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An adapter for brokers speaking Alpaca's REST API: /v2/account,
+// /v2/positions, /v2/orders and /v2/account/activities/FILL, with numbers
+// sent as strings. mockbroker serves the same API locally, along with
+// /mock/advance to move it to a later session.
+
+type alpacaAccount struct {
+	Cash   string `json:"cash"`
+	Equity string `json:"equity"`
+}
+
+type alpacaPosition struct {
+	Symbol        string `json:"symbol"`
+	Qty           string `json:"qty"`
+	AvgEntryPrice string `json:"avg_entry_price"`
+}
+
+type alpacaOrder struct {
+	ID             string    `json:"id,omitempty"`
+	ClientOrderID  string    `json:"client_order_id"`
+	Symbol         string    `json:"symbol"`
+	Qty            string    `json:"qty"`
+	Side           string    `json:"side"`
+	Type           string    `json:"type"`
+	TimeInForce    string    `json:"time_in_force"`
+	LimitPrice     string    `json:"limit_price,omitempty"`
+	Status         string    `json:"status,omitempty"`
+	FilledQty      string    `json:"filled_qty,omitempty"`
+	FilledAvgPrice string    `json:"filled_avg_price,omitempty"`
+	SubmittedAt    time.Time `json:"submitted_at,omitempty"`
+}
+
+type alpacaActivity struct {
+	ID              string    `json:"id"`
+	ActivityType    string    `json:"activity_type"`
+	TransactionTime time.Time `json:"transaction_time"`
+	Symbol          string    `json:"symbol"`
+	Side            string    `json:"side"`
+	Qty             string    `json:"qty"`
+	Price           string    `json:"price"`
+	OrderID         string    `json:"order_id"`
+}
+
+type alpacaError struct {
+	Status  int    `json:"-"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *alpacaError) Error() string {
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+type alpacaBroker struct {
+	url    string
+	key    string
+	secret string
+	client *http.Client
+}
+
+func newAlpacaBroker(baseURL, key, secret string) *alpacaBroker {
+	return &alpacaBroker{
+		url:    strings.TrimRight(baseURL, "/"),
+		key:    key,
+		secret: secret,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *alpacaBroker) do(ctx context.Context, method, path string, body, out interface{}) error {
+	reader := bytes.NewReader(nil)
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("APCA-API-KEY-ID", a.key)
+	req.Header.Set("APCA-API-SECRET-KEY", a.secret)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &alpacaError{Status: resp.StatusCode}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("%s %s: %w", method, path, apiErr)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (a *alpacaBroker) Account(ctx context.Context) (BrokerAccount, error) {
+	var acct alpacaAccount
+	if err := a.do(ctx, "GET", "/v2/account", nil, &acct); err != nil {
+		return BrokerAccount{}, err
+	}
+	return BrokerAccount{Cash: parseNumber(acct.Cash), Equity: parseNumber(acct.Equity)}, nil
+}
+
+func (a *alpacaBroker) Positions(ctx context.Context) ([]Position, error) {
+	var list []alpacaPosition
+	if err := a.do(ctx, "GET", "/v2/positions", nil, &list); err != nil {
+		return nil, err
+	}
+	positions := []Position{}
+	for _, p := range list {
+		positions = append(positions, Position{
+			Ticker:   p.Symbol,
+			Shares:   int(parseNumber(p.Qty)),
+			AvgPrice: parseNumber(p.AvgEntryPrice),
+		})
+	}
+	return positions, nil
+}
+
+// PlaceOrder returns the order already placed under o's client order ID if
+// there is one.
+func (a *alpacaBroker) PlaceOrder(ctx context.Context, o Order) (Order, error) {
+	if existing, ok, err := a.byClientID(ctx, o.ClientOrderID); err != nil || ok {
+		return existing, err
+	}
+	var placed alpacaOrder
+	err := a.do(ctx, "POST", "/v2/orders", toAlpacaOrder(o), &placed)
+	var apiErr *alpacaError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnprocessableEntity {
+		// placed by a concurrent run since we looked
+		if existing, ok, err := a.byClientID(ctx, o.ClientOrderID); err != nil || ok {
+			return existing, err
+		}
+	}
+	if err != nil {
+		return Order{}, err
+	}
+	return placed.order(), nil
+}
+
+func (a *alpacaBroker) byClientID(ctx context.Context, id string) (Order, bool, error) {
+	var o alpacaOrder
+	err := a.do(ctx, "GET", "/v2/orders:by_client_order_id?client_order_id="+url.QueryEscape(id), nil, &o)
+	var apiErr *alpacaError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return Order{}, false, nil
+	}
+	if err != nil {
+		return Order{}, false, err
+	}
+	return o.order(), true, nil
+}
+
+func (a *alpacaBroker) CancelOrder(ctx context.Context, id string) error {
+	return a.do(ctx, "DELETE", "/v2/orders/"+url.PathEscape(id), nil, nil)
+}
+
+func (a *alpacaBroker) OrderStatus(ctx context.Context, id string) (Order, error) {
+	var o alpacaOrder
+	if err := a.do(ctx, "GET", "/v2/orders/"+url.PathEscape(id), nil, &o); err != nil {
+		return Order{}, err
+	}
+	return o.order(), nil
+}
+
+func (a *alpacaBroker) Fills(ctx context.Context, since time.Time) ([]BrokerFill, error) {
+	var list []alpacaActivity
+	path := "/v2/account/activities/FILL?after=" + url.QueryEscape(since.UTC().Format(time.RFC3339))
+	if err := a.do(ctx, "GET", path, nil, &list); err != nil {
+		return nil, err
+	}
+	fills := []BrokerFill{}
+	for _, f := range list {
+		fills = append(fills, BrokerFill{
+			OrderID: f.OrderID,
+			Ticker:  f.Symbol,
+			Side:    f.Side,
+			Shares:  int(parseNumber(f.Qty)),
+			Price:   parseNumber(f.Price),
+			Time:    f.TransactionTime,
+		})
+	}
+	return fills, nil
+}
+
+// Advance posts to mockbroker's /mock/advance to move it on to the close of
+// session date. Brokers without it fill on their own and are left alone.
+func (a *alpacaBroker) Advance(ctx context.Context, date time.Time) ([]Order, error) {
+	var list []alpacaOrder
+	err := a.do(ctx, "POST", "/mock/advance?date="+dateKey(date), nil, &list)
+	var apiErr *alpacaError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	orders := []Order{}
+	for _, o := range list {
+		orders = append(orders, o.order())
+	}
+	return orders, nil
+}
+
+// toAlpacaOrder sends the order types of orders.go as market orders for the
+// opening or closing auction, or as day limit orders. A limit order good for
+// more than one session has to be placed again on the next.
+func toAlpacaOrder(o Order) alpacaOrder {
+	typ, tif := "market", "day"
+	switch o.Type {
+	case orderOpen:
+		tif = "opg"
+	case orderMOC:
+		tif = "cls"
+	case orderLimit:
+		typ = "limit"
+	}
+	return alpacaOrder{
+		ID:             o.ID,
+		ClientOrderID:  o.ClientOrderID,
+		Symbol:         o.Ticker,
+		Qty:            strconv.Itoa(o.Shares),
+		Side:           o.Side,
+		Type:           typ,
+		TimeInForce:    tif,
+		LimitPrice:     formatNumber(o.LimitPrice),
+		Status:         o.Status,
+		FilledQty:      strconv.Itoa(o.FilledShares),
+		FilledAvgPrice: formatNumber(o.FilledPrice),
+		SubmittedAt:    o.Submitted,
+	}
+}
+
+func (ao alpacaOrder) order() Order {
+	o := Order{
+		ID:            ao.ID,
+		ClientOrderID: ao.ClientOrderID,
+		Ticker:        ao.Symbol,
+		Side:          ao.Side,
+		Type:          "market",
+		Shares:        int(parseNumber(ao.Qty)),
+		LimitPrice:    parseNumber(ao.LimitPrice),
+		Status:        ao.Status,
+		FilledShares:  int(parseNumber(ao.FilledQty)),
+		FilledPrice:   parseNumber(ao.FilledAvgPrice),
+		Submitted:     ao.SubmittedAt,
+	}
+	switch {
+	case ao.Type == "limit":
+		o.Type = orderLimit
+	case ao.TimeInForce == "opg":
+		o.Type = orderOpen
+	case ao.TimeInForce == "cls":
+		o.Type = orderMOC
+	}
+	if !ao.SubmittedAt.IsZero() {
+		o.Date = midnight(ao.SubmittedAt)
+	}
+	return o
+}
+
+// parseNumber reads a number sent as a string, treating "" as 0.
+func parseNumber(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+func formatNumber(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
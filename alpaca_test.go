@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAlpacaAgainstMock trades the Alpaca adapter against mockbroker's API,
+// filling from cached bars.
+func TestAlpacaAgainstMock(t *testing.T) {
+	inTempDir(t)
+	d1, d2 := day(t, "2021-03-01"), day(t, "2021-03-02")
+	cacheBars(t, "AAA", []Quote{
+		{Date: d1, Open: 10, High: 11, Low: 9, Close: 10.5, Change: 0.05, HasRange: true},
+		{Date: d2, Open: 11, High: 12, Low: 10, Close: 11.5, Change: 1.0 / 22, HasRange: true},
+	})
+	acct := newAccount(1000)
+	orders, fills := []Order{}, []Fill{}
+	mock := newLocalBroker("mock", acct, &orders, &fills)
+	mock.asOf, acct.Through = d1, d1
+	// hide the orders from the first lookup, as if another run placed the
+	// same order between the lookup and the post
+	hide := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hide && r.URL.Path == "/v2/orders:by_client_order_id" {
+			hide = false
+			writeAPIError(w, http.StatusNotFound, "order not found")
+			return
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	a := newAlpacaBroker(srv.URL, "key", "secret")
+	ctx := context.Background()
+
+	buy := Order{ClientOrderID: "s-2021-03-01-AAA-buy", Ticker: "AAA", Side: "buy", Type: "market", Shares: 20}
+	placed, err := a.PlaceOrder(ctx, buy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed.Status != orderFilled || placed.FilledShares != 20 || placed.FilledPrice != 10.5 {
+		t.Fatalf("placed %+v, want 20 filled at the close of 10.5", placed)
+	}
+	var apiErr *alpacaError
+	if err := a.do(ctx, "POST", "/v2/orders", toAlpacaOrder(buy), nil); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnprocessableEntity {
+		t.Errorf("posting a client order ID again = %v, want a 422", err)
+	}
+	hide = true
+	again, err := a.PlaceOrder(ctx, buy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != placed.ID || len(orders) != 1 {
+		t.Errorf("placing again gave %s with %d orders, want %s with 1", again.ID, len(orders), placed.ID)
+	}
+
+	var list []alpacaOrder
+	if err := a.do(ctx, "GET", "/v2/orders", nil, &list); err != nil || len(list) != 1 || list[0].ClientOrderID != buy.ClientOrderID {
+		t.Errorf("listed %+v, %v", list, err)
+	}
+	status, err := a.OrderStatus(ctx, placed.ID)
+	if err != nil || status.ClientOrderID != buy.ClientOrderID || status.Status != orderFilled {
+		t.Errorf("OrderStatus = %+v, %v", status, err)
+	}
+	positions, err := a.Positions(ctx)
+	if err != nil || len(positions) != 1 || positions[0] != (Position{"AAA", 20, 10.5}) {
+		t.Errorf("Positions = %+v, %v", positions, err)
+	}
+	info, err := a.Account(ctx)
+	if err != nil || info.Cash != 790 || info.Equity != 1000 {
+		t.Errorf("Account = %+v, %v, want 790 cash and 1000 equity", info, err)
+	}
+
+	// an opening order rests until the next session
+	sell := Order{ClientOrderID: "s-2021-03-01-AAA-sell", Ticker: "AAA", Side: "sell", Type: orderOpen, Shares: 20}
+	if placed, err = a.PlaceOrder(ctx, sell); err != nil || placed.Status != orderNew {
+		t.Fatalf("placed %+v, %v, want it resting", placed, err)
+	}
+	done, err := a.Advance(ctx, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Status != orderFilled || done[0].FilledPrice != 11 {
+		t.Errorf("advancing filled %+v, want the sell at the open of 11", done)
+	}
+	if !mock.asOf.Equal(d2) {
+		t.Errorf("advanced to %s, want %s", dateKey(mock.asOf), dateKey(d2))
+	}
+	filled, err := a.Fills(ctx, time.Time{})
+	if err != nil || len(filled) != 2 || filled[1].Side != "sell" || filled[1].Price != 11 {
+		t.Errorf("Fills = %+v, %v", filled, err)
+	}
+	if positions, _ := a.Positions(ctx); len(positions) != 0 {
+		t.Errorf("still holding %+v", positions)
+	}
+
+	// a paper account trading through the mock records each fill once
+	pa := &PaperAccount{Account: *newAccount(1000)}
+	for k := 0; k < 2; k++ {
+		if err := syncFills(ctx, a, pa, d2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(pa.Fills) != 2 || pa.Account.Cash != 1010 || len(pa.Account.Portfolio) != 0 {
+		t.Errorf("synced %d fills to %+v, want 2 ending with 1010 cash", len(pa.Fills), pa.Account)
+	}
+
+	// brokers that fill on their own have no /mock/advance
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+	if done, err := newAlpacaBroker(plain.URL, "", "").Advance(ctx, d2); err != nil || len(done) != 0 {
+		t.Errorf("Advance against a real broker = %v, %v", done, err)
+	}
+}
+
+func TestLocalBrokerRejects(t *testing.T) {
+	inTempDir(t)
+	d := day(t, "2021-03-01")
+	cacheBars(t, "AAA", []Quote{{Date: d, Close: 10, Change: 0}})
+	acct := newAccount(100)
+	b := newLocalBroker("mock", acct, &[]Order{}, &[]Fill{})
+	ctx := context.Background()
+	for _, o := range []Order{
+		{Ticker: "AAA", Side: "buy", Type: "market", Shares: 11, Date: d}, // more than the cash
+		{Ticker: "AAA", Side: "sell", Type: "market", Shares: 1, Date: d}, // not held
+	} {
+		placed, err := b.PlaceOrder(ctx, o)
+		if err != nil || placed.Status != orderRejected {
+			t.Errorf("%s %d: %+v, %v, want it rejected", o.Side, o.Shares, placed, err)
+		}
+	}
+	if _, err := b.PlaceOrder(ctx, Order{Ticker: "AAA", Side: "short", Type: "market", Shares: 1}); err == nil || !strings.Contains(err.Error(), "side") {
+		t.Errorf("placed an order to short, %v", err)
+	}
+}
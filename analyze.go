@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Analyses of the earnings calendar against the quotes, to see what edge
+// there is before trading it. The events are every (ticker, date) in the
+// earningdate/ cache, filtered by universe as of the date. As in earnings
+// history, the reaction is the change from the open to the close on the
+// session the report lands in, which is the next one for companies
+// reporting after the close.
+
+var eventFlags = []cli.Flag{
+	cli.StringFlag{Name: "from", Usage: "first earnings date (default the first cached)"},
+	cli.StringFlag{Name: "to", Usage: "last earnings date (default the last cached)"},
+	cli.StringFlag{Name: "universe", Value: "russell2k", Usage: "only companies in `NAME` on the date, or all"},
+	cli.StringSliceFlag{Name: "ticker", Usage: "only these tickers, from any universe"},
+	cli.BoolFlag{Name: "cache-only", Usage: "use only the cached quotes, leaving out what they miss"},
+	formatFlag,
+}
+
+var analyzeCommands = []cli.Command{
+	{
+		Name:  "drift",
+		Usage: "average returns after earnings, bucketed by the day-0 reaction",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{Name: "horizons", Value: "1,5,20,60", Usage: "trading days after the reaction to measure returns at"},
+			cli.StringFlag{Name: "buckets", Value: "-10,-7.5,-5,-2.5,0,2.5,5,7.5,10", Usage: "reaction bucket edges in percent"},
+			cli.BoolFlag{Name: "events", Usage: "list every event rather than the buckets"},
+		}, eventFlags...),
+		Action: analyzeDrift,
+	},
+	{
+		Name:   "events",
+		Usage:  "event study of the abnormal returns around earnings",
+		Flags:  eventStudyFlags,
+		Action: analyzeEvents,
+	},
+	{
+		Name:   "sensitivity",
+		Usage:  "CAGR and drawdown of a strategy over a grid of two parameters",
+		Flags:  sensitivityFlags,
+		Action: sensitivity,
+	},
+}
+
+// calendarEvent is a company reporting on the earnings calendar.
+type calendarEvent struct {
+	Ticker string
+	Date   time.Time
+	Timing string
+}
+
+// Reaction is the session the report lands in.
+func (e calendarEvent) Reaction() time.Time {
+	return reactionDate(e.Date, e.Timing)
+}
+
+// calendarEvents reads the events asked for with eventFlags from the cache,
+// ordered by date and ticker.
+func calendarEvents(c *cli.Context) ([]calendarEvent, error) {
+	var from, to time.Time
+	var err error
+	if c.String("from") != "" {
+		if from, err = parseDate(c.String("from")); err != nil {
+			return nil, err
+		}
+	}
+	if c.String("to") != "" {
+		if to, err = parseDate(c.String("to")); err != nil {
+			return nil, err
+		}
+	}
+	tickers := make(map[string]bool)
+	for _, t := range c.StringSlice("ticker") {
+		tickers[strings.ToUpper(t)] = true
+	}
+	var members *Membership
+	if len(tickers) == 0 && c.String("universe") != "all" {
+		if _, err := loadMetadata(); err != nil {
+			return nil, err
+		}
+		if members, err = loadMembership(c.String("universe")); err != nil {
+			return nil, err
+		}
+	}
+	files, err := ioutil.ReadDir("earningdate")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	events, stale := []calendarEvent{}, 0
+	var first, last time.Time
+	for _, f := range files {
+		date, err := time.ParseInLocation(dateLayout, f.Name(), exchangeTZ)
+		if err != nil || (!from.IsZero() && date.Before(from)) || (!to.IsZero() && date.After(to)) {
+			continue
+		}
+		e := new(EarningDate)
+		path := filepath.Join("earningdate", f.Name())
+		if err := Load(path, e); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if e.Version < earningsVersion {
+			stale++
+		}
+		if first.IsZero() {
+			first = date
+		}
+		last = date
+		stocks := filterEarnings(e.Stocks, members, date)
+		sort.Strings(stocks)
+		for _, ticker := range stocks {
+			if len(tickers) > 0 && !tickers[ticker] {
+				continue
+			}
+			events = append(events, calendarEvent{Ticker: ticker, Date: date, Timing: e.Events[ticker].Timing})
+		}
+	}
+	warnStaleEarnings(stale)
+	// every company reports each quarter, so a longer span without most of
+	// the members is a cache that didn't list them
+	if members != nil && last.Sub(first) > 100*24*time.Hour {
+		reported := make(map[string]bool)
+		for _, e := range events {
+			reported[e.Ticker] = true
+		}
+		listed, missing := members.Members(last), 0
+		for _, ticker := range listed {
+			if !reported[ticker] {
+				missing++
+			}
+		}
+		if missing > len(listed)/2 {
+			fmt.Fprintf(os.Stderr, "warning: %d of %d %s members have no earnings from %s to %s, is the cache for another universe?\n",
+				missing, len(listed), c.String("universe"), dateKey(first), dateKey(last))
+		}
+	}
+	return events, nil
+}
+
+// eventQuotes loads the quotes of every ticker in events, fetching the
+// sessions from before to after sessions around the events that the cache
+// misses unless cacheOnly is set.
+func eventQuotes(ctx context.Context, events []calendarEvent, before, after int, cacheOnly bool) (map[string]*Quotes, error) {
+	first, last := make(map[string]time.Time), make(map[string]time.Time)
+	for _, e := range events {
+		if d, ok := first[e.Ticker]; !ok || e.Date.Before(d) {
+			first[e.Ticker] = e.Date
+		}
+		if d, ok := last[e.Ticker]; !ok || e.Reaction().After(d) {
+			last[e.Ticker] = e.Reaction()
+		}
+	}
+	quotes := make(map[string]*Quotes)
+	for ticker := range first {
+		var q *Quotes
+		var err error
+		if cacheOnly {
+			q, err = loadQuotes(quoteFile(ticker))
+		} else {
+			end := SessionOffset(last[ticker], after+1)
+			if now := time.Now(); end.After(now) {
+				end = now
+			}
+			q, err = ensureBars(ctx, ticker, SessionOffset(first[ticker], -before), end)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ticker, err)
+		}
+		quotes[ticker] = q
+	}
+	return quotes, nil
+}
+
+// parseNumbers reads a comma separated list of numbers.
+func parseNumbers(s string) ([]float64, error) {
+	numbers := []float64{}
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", part)
+		}
+		numbers = append(numbers, v)
+	}
+	return numbers, nil
+}
+
+// round4 keeps tables of returns readable.
+func round4(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
+
+// drift is an event with the change on its reaction session and the returns
+// from that session's close at each horizon, NaN where there is no close.
+type drift struct {
+	calendarEvent
+	Change  float64
+	Returns []float64
+}
+
+func analyzeDrift(c *cli.Context) error {
+	format := c.String("format")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	horizons := []int{}
+	list, err := parseNumbers(c.String("horizons"))
+	if err != nil {
+		return fmt.Errorf("--horizons: %v", err)
+	}
+	for _, h := range list {
+		if h < 1 || h != math.Trunc(h) {
+			return fmt.Errorf("--horizons: %g is not a number of trading days", h)
+		}
+		horizons = append(horizons, int(h))
+	}
+	sort.Ints(horizons)
+	if len(horizons) == 0 {
+		return fmt.Errorf("--horizons: none given")
+	}
+	edges, err := parseNumbers(c.String("buckets"))
+	if err != nil {
+		return fmt.Errorf("--buckets: %v", err)
+	}
+	sort.Float64s(edges)
+
+	events, err := calendarEvents(c)
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	quotes, err := eventQuotes(ctx, events, 0, horizons[len(horizons)-1], c.Bool("cache-only"))
+	if err != nil {
+		return err
+	}
+	drifts := []drift{}
+	for _, e := range events {
+		q := quotes[e.Ticker]
+		day0, ok := q.quote(dateKey(e.Reaction()))
+		if !ok {
+			continue
+		}
+		d := drift{calendarEvent: e, Change: day0.Change}
+		for _, h := range horizons {
+			r := math.NaN()
+			if later, ok := q.quote(dateKey(SessionOffset(e.Reaction(), h))); ok {
+				r = later.Close/day0.Close - 1
+			}
+			d.Returns = append(d.Returns, r)
+		}
+		drifts = append(drifts, d)
+	}
+	if len(events) > len(drifts) {
+		fmt.Fprintf(os.Stderr, "%d of %d events have no quote for the reaction session\n", len(events)-len(drifts), len(events))
+	}
+
+	records := []record{}
+	if c.Bool("events") {
+		for _, d := range drifts {
+			r := record{
+				{"date", dateKey(d.Date)},
+				{"ticker", d.Ticker},
+				{"timing", d.Timing},
+				{"reaction_date", dateKey(d.Reaction())},
+				{"reaction", round4(d.Change)},
+				{"bucket", bucketLabel(edges, bucketOf(edges, d.Change))},
+			}
+			for j, h := range horizons {
+				var v interface{}
+				if !math.IsNaN(d.Returns[j]) {
+					v = round4(d.Returns[j])
+				}
+				r = append(r, field{fmt.Sprintf("ret_%dd", h), v})
+			}
+			records = append(records, r)
+		}
+		return printRecords(format, records)
+	}
+
+	buckets := make([][]drift, len(edges)+1)
+	for _, d := range drifts {
+		b := bucketOf(edges, d.Change)
+		buckets[b] = append(buckets[b], d)
+	}
+	for b, list := range buckets {
+		if len(list) == 0 {
+			continue
+		}
+		reaction := 0.0
+		for _, d := range list {
+			reaction += d.Change
+		}
+		r := record{
+			{"bucket", bucketLabel(edges, b)},
+			{"events", len(list)},
+			{"avg_reaction", round4(reaction / float64(len(list)))},
+		}
+		for j, h := range horizons {
+			sum, hits, n := 0.0, 0, 0
+			for _, d := range list {
+				if v := d.Returns[j]; !math.IsNaN(v) {
+					sum += v
+					n++
+					if v > 0 {
+						hits++
+					}
+				}
+			}
+			var avg, hit interface{}
+			if n > 0 {
+				avg, hit = round4(sum/float64(n)), round4(float64(hits)/float64(n))
+			}
+			r = append(r, field{fmt.Sprintf("drift_%dd", h), avg}, field{fmt.Sprintf("hit_%dd", h), hit})
+		}
+		records = append(records, r)
+	}
+	return printRecords(format, records)
+}
+
+// bucketOf is the index of the bucket reaction falls in, the buckets being
+// split at edges given in percent.
+func bucketOf(edges []float64, reaction float64) int {
+	return sort.Search(len(edges), func(i int) bool { return edges[i] > reaction*100 })
+}
+
+func bucketLabel(edges []float64, b int) string {
+	switch {
+	case len(edges) == 0:
+		return "all"
+	case b == 0:
+		return fmt.Sprintf("< %g%%", edges[0])
+	case b == len(edges):
+		return fmt.Sprintf(">= %g%%", edges[b-1])
+	}
+	return fmt.Sprintf("%g%% to %g%%", edges[b-1], edges[b])
+}
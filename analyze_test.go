@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestBucketOf(t *testing.T) {
+	edges := []float64{-5, 0, 5}
+	for _, c := range []struct {
+		reaction float64
+		bucket   int
+		label    string
+	}{
+		{-0.10, 0, "< -5%"},
+		{-0.05, 1, "-5% to 0%"},
+		{-0.01, 1, "-5% to 0%"},
+		{0, 2, "0% to 5%"},
+		{0.049, 2, "0% to 5%"},
+		{0.05, 3, ">= 5%"},
+		{0.20, 3, ">= 5%"},
+	} {
+		b := bucketOf(edges, c.reaction)
+		if b != c.bucket || bucketLabel(edges, b) != c.label {
+			t.Errorf("bucketOf(%g) = %d %q, want %d %q", c.reaction, b, bucketLabel(edges, b), c.bucket, c.label)
+		}
+	}
+	if b := bucketOf(nil, 0.03); b != 0 || bucketLabel(nil, b) != "all" {
+		t.Errorf("without edges bucketOf = %d %q", b, bucketLabel(nil, b))
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Brokers take the trades a strategy decides on as orders. Every order
+// carries a client order ID made from the strategy, the session, the ticker
+// and the side, and brokers return the existing order when one with the same
+// ID comes in again, so running the same day twice doesn't trade twice.
+
+type Broker interface {
+	Account(ctx context.Context) (BrokerAccount, error)
+	Positions(ctx context.Context) ([]Position, error)
+	PlaceOrder(ctx context.Context, o Order) (Order, error)
+	CancelOrder(ctx context.Context, id string) error
+	OrderStatus(ctx context.Context, id string) (Order, error)
+	Fills(ctx context.Context, since time.Time) ([]BrokerFill, error)
+}
+
+// sessionClock is a broker that has to be told when a session closes to
+// fill the orders resting with it, as the local ones do. Real brokers fill
+// on their own.
+type sessionClock interface {
+	Advance(ctx context.Context, date time.Time) ([]Order, error)
+}
+
+// advanceBroker moves b on to the close of session date if it keeps a
+// session clock, returning the orders it is done with.
+func advanceBroker(ctx context.Context, b Broker, date time.Time) ([]Order, error) {
+	if c, ok := b.(sessionClock); ok {
+		return c.Advance(ctx, date)
+	}
+	return nil, nil
+}
+
+type BrokerAccount struct {
+	Cash   float64
+	Equity float64
+}
+
+type Position struct {
+	Ticker   string
+	Shares   int
+	AvgPrice float64
+}
+
+const (
+	orderNew      = "new"
+	orderFilled   = "filled"
+	orderCanceled = "canceled"
+	orderRejected = "rejected"
+)
+
+type Order struct {
+	ID            string
+	ClientOrderID string
+	Ticker        string
+	Side          string // "buy" or "sell"
+	Type          string // "market", or one of the types in orders.go
+	Shares        int
+	Date          time.Time // market orders fill at its close, others after it
+	LimitPrice    float64
+	Price         float64   // close the order was sized at
+	Expires       time.Time // last session a resting order can fill on
+	Status        string
+	FilledShares  int
+	FilledPrice   float64
+	Submitted     time.Time
+}
+
+type BrokerFill struct {
+	OrderID string
+	Ticker  string
+	Side    string
+	Shares  int
+	Price   float64
+	Time    time.Time
+}
+
+var tradeFlags = []cli.Flag{
+	cli.StringFlag{Name: "strategy", Usage: "strategy to trade (default the first)"},
+	cli.StringFlag{Name: "date", Usage: "session to trade (default today)"},
+	cli.StringFlag{Name: "url", Value: "https://paper-api.alpaca.markets", EnvVar: "APCA_API_BASE_URL", Usage: "base URL of the broker API"},
+	cli.StringFlag{Name: "key", EnvVar: "APCA_API_KEY_ID", Usage: "API key ID"},
+	cli.StringFlag{Name: "secret", EnvVar: "APCA_API_SECRET_KEY", Usage: "API secret key"},
+	cli.BoolFlag{Name: "dry-run", Usage: "print the orders without placing them"},
+}
+
+// clientOrderID names the order of s for ticker on date. It stays the same
+// across reruns of the same session.
+func clientOrderID(s Strategy, date time.Time, ticker, side string) string {
+	return fmt.Sprintf("%s-%s-%s-%s", strategyHash(s)[:8], dateKey(date), ticker, side)
+}
+
+// orderFor turns a BUY or SELL of s at the close into a market order.
+func orderFor(s Strategy, t Trade) Order {
+	side := strings.ToLower(t.Action)
+	return Order{
+		ClientOrderID: clientOrderID(s, t.Date, t.Ticker, side),
+		Ticker:        t.Ticker,
+		Side:          side,
+		Type:          "market",
+		Shares:        t.Shares,
+		Date:          t.Date,
+	}
+}
+
+// brokerState is the account of b in the form the rules trade on.
+func brokerState(ctx context.Context, b Broker, date time.Time) (*Account, error) {
+	info, err := b.Account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := b.Positions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	acct := newAccount(info.Cash)
+	for _, p := range positions {
+		acct.Portfolio[p.Ticker] = p.Shares
+		acct.LastPrice[p.Ticker] = p.AvgPrice
+		q, ok, err := lastClose(ctx, p.Ticker, date)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			acct.LastPrice[p.Ticker] = q.Close
+		}
+	}
+	return acct, nil
+}
+
+// trade runs the rules of a strategy on a session against a live broker
+// account and places the orders.
+func trade(c *cli.Context) error {
+	s, err := findStrategy(c.String("strategy"))
+	if err != nil {
+		return err
+	}
+	date := midnight(time.Now())
+	if c.String("date") != "" {
+		if date, err = parseDate(c.String("date")); err != nil {
+			return err
+		}
+	}
+	if !IsTradingDay(date) {
+		return fmt.Errorf("%s is not a trading day", dateKey(date))
+	}
+	if _, err := loadMetadata(); err != nil {
+		return err
+	}
+	members, err := loadMembership(s.Index)
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	b := newAlpacaBroker(c.String("url"), c.String("key"), c.String("secret"))
+	acct, err := brokerState(ctx, b, date)
+	if err != nil {
+		return err
+	}
+	if err := tradeDay(ctx, s, acct, members, date, nil); err != nil {
+		return err
+	}
+	if acct.Skipped > 0 {
+		fmt.Fprintf(os.Stderr, "%d reporters have no quote for %s\n", acct.Skipped, dateKey(date))
+	}
+	orders := []Order{}
+	for _, t := range acct.Ledger {
+		if t.Action == "BUY" || t.Action == "SELL" {
+			orders = append(orders, orderFor(s, t))
+		}
+	}
+	for _, o := range append(orders, acct.Orders...) {
+		if c.Bool("dry-run") {
+			fmt.Printf("%s %s %d %s %s\n", o.ClientOrderID, o.Side, o.Shares, o.Ticker, o.Type)
+			continue
+		}
+		placed, err := b.PlaceOrder(ctx, o)
+		if err != nil {
+			return fmt.Errorf("%s: %v", o.ClientOrderID, err)
+		}
+		fmt.Printf("%s %s %d %s: %s\n", placed.ClientOrderID, placed.Side, placed.Shares, placed.Ticker, placed.Status)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"sync"
+	"time"
+	_ "time/tzdata"
+)
+
+// NYSE trading calendar: weekends, exchange holidays, unscheduled closures
+// and the 1pm early closes. Trading dates are midnight in exchangeTZ, and any
+// other time is taken to be on the date it falls on in New York.
+
+var exchangeTZ = mustLoadLocation("America/New_York")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// dateKey is the trading date of t, as used for cache keys and file names.
+func dateKey(t time.Time) string {
+	return t.In(exchangeTZ).Format(dateLayout)
+}
+
+// yearsAgo is the trading date n years before today.
+func yearsAgo(n int) time.Time {
+	return midnight(time.Now()).AddDate(-n, 0, 0)
+}
+
+// closures are the days the exchange shut outside of the holiday rules.
+var closures = map[string]string{
+	"1994-04-27": "Nixon funeral",
+	"2001-09-11": "September 11",
+	"2001-09-12": "September 11",
+	"2001-09-13": "September 11",
+	"2001-09-14": "September 11",
+	"2004-06-11": "Reagan funeral",
+	"2007-01-02": "Ford funeral",
+	"2012-10-29": "Hurricane Sandy",
+	"2012-10-30": "Hurricane Sandy",
+	"2018-12-05": "George H.W. Bush funeral",
+	"2025-01-09": "Carter funeral",
+}
+
+var (
+	holidayMu    sync.Mutex
+	holidayYears = make(map[int]map[string]string)
+)
+
+// Holiday returns the name of the holiday or closure on date, if any.
+func Holiday(date time.Time) (string, bool) {
+	key := dateKey(date)
+	if name, ok := closures[key]; ok {
+		return name, true
+	}
+	holidayMu.Lock()
+	defer holidayMu.Unlock()
+	y := date.In(exchangeTZ).Year()
+	year, ok := holidayYears[y]
+	if !ok {
+		year = holidays(y)
+		holidayYears[y] = year
+	}
+	name, ok := year[key]
+	return name, ok
+}
+
+func holidays(year int) map[string]string {
+	days := make(map[string]string)
+	add := func(name string, d time.Time) {
+		days[d.Format(dateLayout)] = name
+	}
+	// New Year's Day on a Saturday is not made up on the Friday before.
+	if newYear := civil(year, time.January, 1); newYear.Weekday() != time.Saturday {
+		add("New Year's Day", observed(newYear))
+	}
+	if year >= 1998 {
+		add("Martin Luther King Jr. Day", nthWeekday(year, time.January, time.Monday, 3))
+	}
+	add("Washington's Birthday", nthWeekday(year, time.February, time.Monday, 3))
+	add("Good Friday", easter(year).AddDate(0, 0, -2))
+	add("Memorial Day", nthWeekday(year, time.June, time.Monday, 1).AddDate(0, 0, -7))
+	if year >= 2022 {
+		add("Juneteenth", observed(civil(year, time.June, 19)))
+	}
+	add("Independence Day", observed(civil(year, time.July, 4)))
+	add("Labor Day", nthWeekday(year, time.September, time.Monday, 1))
+	add("Thanksgiving", nthWeekday(year, time.November, time.Thursday, 4))
+	add("Christmas", observed(civil(year, time.December, 25)))
+	return days
+}
+
+// IsTradingDay reports whether the exchange is open on date.
+func IsTradingDay(date time.Time) bool {
+	date = date.In(exchangeTZ)
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := Holiday(date)
+	return !holiday
+}
+
+// EarlyClose reports whether the session on date closes at 1pm: the day
+// before Independence Day, the day after Thanksgiving and Christmas Eve.
+func EarlyClose(date time.Time) bool {
+	date = date.In(exchangeTZ)
+	if !IsTradingDay(date) {
+		return false
+	}
+	switch {
+	case date.Month() == time.July && date.Day() == 3:
+		return true
+	case date.Month() == time.December && date.Day() == 24:
+		return true
+	case date.Month() == time.November && date.Weekday() == time.Friday:
+		thanksgiving := nthWeekday(date.Year(), time.November, time.Thursday, 4)
+		return sameDay(date, thanksgiving.AddDate(0, 0, 1))
+	}
+	return false
+}
+
+// SessionClose is when trading ends on date.
+func SessionClose(date time.Time) time.Time {
+	if EarlyClose(date) {
+		return midnight(date).Add(13 * time.Hour)
+	}
+	return midnight(date).Add(16 * time.Hour)
+}
+
+// sessionClosed reports whether the session date falls on is over.
+func sessionClosed(date time.Time) bool {
+	return time.Now().After(SessionClose(date))
+}
+
+// Sessions lists the trading days from start up to, not including, end.
+func Sessions(start, end time.Time) []time.Time {
+	sessions := []time.Time{}
+	for d := midnight(start); d.Before(end); d = d.AddDate(0, 0, 1) {
+		if IsTradingDay(d) {
+			sessions = append(sessions, d)
+		}
+	}
+	return sessions
+}
+
+// PreviousSession is the last trading day before date.
+func PreviousSession(date time.Time) time.Time {
+	return SessionOffset(midnight(date), -1)
+}
+
+// SessionOffset moves n trading days from date. With n == 0 it returns date
+// if that is a trading day and the next one otherwise.
+func SessionOffset(date time.Time, n int) time.Time {
+	d := midnight(date)
+	if n == 0 {
+		for !IsTradingDay(d) {
+			d = d.AddDate(0, 0, 1)
+		}
+		return d
+	}
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for n > 0 {
+		d = d.AddDate(0, 0, step)
+		if IsTradingDay(d) {
+			n--
+		}
+	}
+	return d
+}
+
+// midnight is the start of the trading date t falls on.
+func midnight(t time.Time) time.Time {
+	t = t.In(exchangeTZ)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, exchangeTZ)
+}
+
+func civil(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
+
+// observed moves a Saturday holiday to Friday and a Sunday one to Monday.
+func observed(d time.Time) time.Time {
+	switch d.Weekday() {
+	case time.Saturday:
+		return d.AddDate(0, 0, -1)
+	case time.Sunday:
+		return d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	d := civil(year, month, 1)
+	for d.Weekday() != weekday {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d.AddDate(0, 0, 7*(n-1))
+}
+
+// easter computes Easter Sunday with the anonymous Gregorian algorithm.
+func easter(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return civil(year, time.Month(month), day)
+}
@@ -0,0 +1,113 @@
+package main
+
+import "testing"
+
+func TestEaster(t *testing.T) {
+	for _, c := range []struct {
+		year int
+		want string
+	}{
+		{2000, "2000-04-23"},
+		{2008, "2008-03-23"},
+		{2018, "2018-04-01"},
+		{2019, "2019-04-21"},
+		{2024, "2024-03-31"},
+		{2025, "2025-04-20"},
+	} {
+		if got := easter(c.year).Format(dateLayout); got != c.want {
+			t.Errorf("easter(%d) = %s, want %s", c.year, got, c.want)
+		}
+	}
+}
+
+func TestIsTradingDay(t *testing.T) {
+	for _, c := range []struct {
+		date string
+		want bool
+	}{
+		{"2018-07-06", true},
+		{"2018-07-07", false}, // Saturday
+		{"2018-07-04", false}, // Independence Day
+		{"2020-07-03", false}, // Independence Day on a Saturday
+		{"2018-03-30", false}, // Good Friday
+		{"2018-05-28", false}, // Memorial Day
+		{"2018-11-22", false}, // Thanksgiving
+		{"2021-12-24", false}, // Christmas on a Saturday
+		{"2017-01-02", false}, // New Year's Day on a Sunday
+		{"2021-12-31", true},  // New Year's Day on a Saturday isn't made up
+		{"1997-01-20", true},  // before Martin Luther King Jr. Day
+		{"1998-01-19", false},
+		{"2021-06-18", true}, // before Juneteenth
+		{"2022-06-20", false},
+		{"2018-12-05", false}, // closure
+		{"2012-10-29", false},
+	} {
+		if got := IsTradingDay(day(t, c.date)); got != c.want {
+			t.Errorf("IsTradingDay(%s) = %v, want %v", c.date, got, c.want)
+		}
+	}
+}
+
+func TestEarlyClose(t *testing.T) {
+	for _, c := range []struct {
+		date string
+		want bool
+	}{
+		{"2018-07-03", true},
+		{"2018-11-23", true},
+		{"2018-12-24", true},
+		{"2018-07-05", false},
+		{"2018-11-30", false},
+		{"2020-07-03", false}, // a holiday, not an early close
+		{"2021-12-24", false},
+	} {
+		if got := EarlyClose(day(t, c.date)); got != c.want {
+			t.Errorf("EarlyClose(%s) = %v, want %v", c.date, got, c.want)
+		}
+	}
+	if got := SessionClose(day(t, "2018-07-03")).Hour(); got != 13 {
+		t.Errorf("SessionClose(2018-07-03) at %d, want 13", got)
+	}
+	if got := SessionClose(day(t, "2018-07-05")).Hour(); got != 16 {
+		t.Errorf("SessionClose(2018-07-05) at %d, want 16", got)
+	}
+}
+
+func TestSessionOffset(t *testing.T) {
+	for _, c := range []struct {
+		date string
+		n    int
+		want string
+	}{
+		{"2018-07-03", 1, "2018-07-05"},
+		{"2018-07-05", -1, "2018-07-03"},
+		{"2018-07-06", 0, "2018-07-06"},
+		{"2018-07-07", 0, "2018-07-09"},
+		{"2018-07-07", 1, "2018-07-09"},
+		{"2018-07-07", -1, "2018-07-06"},
+		{"2018-07-09", -1, "2018-07-06"},
+		{"2018-12-04", 1, "2018-12-06"},
+		{"2018-12-31", 5, "2019-01-08"},
+		{"2019-01-08", -5, "2018-12-31"},
+	} {
+		if got := dateKey(SessionOffset(day(t, c.date), c.n)); got != c.want {
+			t.Errorf("SessionOffset(%s, %d) = %s, want %s", c.date, c.n, got, c.want)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	got := []string{}
+	for _, d := range Sessions(day(t, "2018-07-02"), day(t, "2018-07-10")) {
+		got = append(got, dateKey(d))
+	}
+	want := []string{"2018-07-02", "2018-07-03", "2018-07-05", "2018-07-06", "2018-07-09"}
+	if len(got) != len(want) {
+		t.Fatalf("Sessions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Sessions = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Checkpoints save a strategy's account every checkpointSessions trading days
+// to checkpoints/<hash>, where the hash covers everything that defines the
+// strategy except its name. A resumed run carries on from the last one, and
+// a strategy that changed since hashes differently and starts over.
+
+const checkpointSessions = 21
+
+type Checkpoint struct {
+	Hash    string
+	Start   time.Time
+	Account Account
+}
+
+// definition is s without its name and results.
+func (s Strategy) definition() Strategy {
+	s.Name = ""
+	s.Total = 0
+	s.Ledger = nil
+	s.Equity = nil
+	s.SectorPnL = nil
+	s.Skipped = 0
+	s.Unfilled = 0
+	s.Partial = false
+	s.Start = time.Time{}
+	s.Through = time.Time{}
+	return s
+}
+
+func strategyHash(s Strategy) string {
+	data, err := json.Marshal(s.definition())
+	if err != nil {
+		panic(err) // a Strategy always marshals
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func checkpointFile(hash string) string {
+	return fmt.Sprintf("checkpoints/%s", hash)
+}
+
+// loadCheckpoint returns the checkpoint of s, or nil if there is none.
+func loadCheckpoint(s Strategy) (*Checkpoint, error) {
+	hash := strategyHash(s)
+	file := checkpointFile(hash)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, nil
+	}
+	cp := new(Checkpoint)
+	if err := Load(file, cp); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if cp.Hash != hash {
+		return nil, nil
+	}
+	if cp.Account.Portfolio == nil {
+		cp.Account.Portfolio = make(map[string]int)
+	}
+	if cp.Account.LastPrice == nil {
+		cp.Account.LastPrice = make(map[string]float64)
+	}
+	return cp, nil
+}
+
+func saveCheckpoint(s Strategy, start time.Time, acct *Account) error {
+	if err := os.MkdirAll("checkpoints", 0755); err != nil {
+		return err
+	}
+	cp := Checkpoint{Hash: strategyHash(s), Start: start, Account: *acct}
+	file := checkpointFile(cp.Hash)
+	// write and rename so an interrupted save leaves the old checkpoint
+	if err := Save(file+".tmp", cp); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return os.Rename(file+".tmp", file)
+}
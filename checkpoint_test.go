@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+// writeMarket caches a made up market of tickers over the sessions from
+// start up to end in the working directory: an index "mkt" they are all in,
+// daily bars moving up to 6% a day, and an earnings calendar with a few of
+// them reporting every session.
+func writeMarket(t *testing.T, start, end time.Time, tickers ...string) {
+	t.Helper()
+	rows := "ticker,added,removed\n"
+	for _, ticker := range tickers {
+		rows += ticker + ",,\n"
+	}
+	writeTestFile(t, "constituents/mkt.csv", rows)
+	if err := os.MkdirAll("earningdate", 0755); err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	bars := make(map[string][]Quote)
+	price := make(map[string]float64)
+	for _, ticker := range tickers {
+		price[ticker] = 20 + 10*r.Float64()
+	}
+	for n, d := range Sessions(start, end) {
+		e := EarningDate{Date: d, Version: earningsVersion}
+		for k, ticker := range tickers {
+			open := price[ticker] * (1 + 0.02*(r.Float64()-0.5))
+			closePrice := open * (1 + 0.12*(r.Float64()-0.5))
+			bars[ticker] = append(bars[ticker], Quote{
+				Date:     d,
+				Open:     open,
+				High:     math.Max(open, closePrice) * 1.01,
+				Low:      math.Min(open, closePrice) * 0.99,
+				Close:    closePrice,
+				Change:   (closePrice - open) / open,
+				HasRange: true,
+			})
+			price[ticker] = closePrice
+			if (n+k)%3 == 0 {
+				e.Stocks = append(e.Stocks, ticker)
+			}
+		}
+		if err := Save(earningsFile(d), &e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for ticker, b := range bars {
+		cacheBars(t, ticker, b)
+	}
+}
+
+// sameResult compares the results of two runs, allowing for the order the
+// positions were added up in.
+func sameResult(a, b Strategy) bool {
+	if !near(a.Total, b.Total) || len(a.Ledger) != len(b.Ledger) || len(a.Equity) != len(b.Equity) {
+		return false
+	}
+	for i, t := range a.Ledger {
+		u := b.Ledger[i]
+		if !t.Date.Equal(u.Date) || t.Ticker != u.Ticker || t.Action != u.Action || t.Shares != u.Shares || t.Price != u.Price {
+			return false
+		}
+	}
+	for i, v := range a.Equity {
+		if !near(v, b.Equity[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStrategyHash(t *testing.T) {
+	s := Strategy{Name: "a", NumYears: 5, Index: "russell2k", ThresholdPct: 0.05, StartCash: 20000, Increment: 2500}
+	done := s
+	done.Name, done.Total, done.Partial = "b", 30000, true
+	done.Ledger = []Trade{{Ticker: "AAA", Action: "BUY", Shares: 1, Price: 1}}
+	done.Equity = []float64{20000, 30000}
+	done.Start, done.Through = time.Now().AddDate(-5, 0, 0), time.Now()
+	if strategyHash(done) != strategyHash(s) {
+		t.Errorf("the name and the results changed the hash")
+	}
+	for _, change := range []func(s *Strategy){
+		func(s *Strategy) { s.ThresholdPct = 0.06 },
+		func(s *Strategy) { s.Index = "sp500" },
+		func(s *Strategy) { s.ExcludeSectors = []string{"Energy"} },
+		func(s *Strategy) { s.EntryOrder = orderLimit },
+	} {
+		other := s
+		change(&other)
+		if strategyHash(other) == strategyHash(s) {
+			t.Errorf("%+v hashes the same as %+v", other, s)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	inTempDir(t)
+	start, mid, end := day(t, "2021-01-04"), day(t, "2021-03-01"), day(t, "2021-05-03")
+	writeMarket(t, start, end, "AAA", "BBB", "CCC", "DDD")
+	s := Strategy{Name: "resume", Index: "mkt", ThresholdPct: 0.02, StartCash: 10000, Increment: 1000}
+	ctx := context.Background()
+
+	whole := startStrat(ctx, s, false, start, end)
+	if err := simulateStrats(ctx, []*runner{whole}, end); err != nil {
+		t.Fatal(err)
+	}
+	want, err := finishStrat(ctx, whole, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want.Ledger) == 0 {
+		t.Fatal("nothing traded")
+	}
+
+	os.RemoveAll("checkpoints")
+	first := startStrat(ctx, s, false, start, end)
+	if err := simulateStrats(ctx, []*runner{first}, mid); err != nil {
+		t.Fatal(err)
+	}
+	resumed := startStrat(ctx, s, true, start, end)
+	if resumed.Err != nil {
+		t.Fatal(resumed.Err)
+	}
+	if !resumed.From.After(start) {
+		t.Fatalf("resumed from %s, not from the checkpoint", dateKey(resumed.From))
+	}
+	if err := simulateStrats(ctx, []*runner{resumed}, end); err != nil {
+		t.Fatal(err)
+	}
+	got, err := finishStrat(ctx, resumed, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameResult(got, want) {
+		t.Errorf("resumed run ended with %f after %d trades, want %f after %d", got.Total, len(got.Ledger), want.Total, len(want.Ledger))
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// The earnings calendar. Besides the tickers, the calendar page says when in
+// the day a company reports and what EPS is expected where it knows; both are
+// picked out of the text between one ticker and the next, and left empty when
+// the page doesn't say.
+
+const (
+	timingBefore = "before open"
+	timingAfter  = "after close"
+	timingDuring = "during"
+)
+
+// EarningEvent is what the calendar says about one company's release.
+type EarningEvent struct {
+	Timing      string
+	Estimate    float64
+	HasEstimate bool
+}
+
+var (
+	tickerPattern   = regexp.MustCompile(`/companies/security/(\w{1,4}):US`)
+	timingPattern   = regexp.MustCompile(`(?i)before[ -]market[ -]open|before[ -]open|pre[ -]market|\bbmo\b|after[ -]market[ -]close|after[ -]close|post[ -]market|\bamc\b|during[ -]market`)
+	estimatePattern = regexp.MustCompile(`(?i)"?eps[ _]?estimate"?\s*:\s*"?(-?\d+(?:\.\d+)?)`)
+)
+
+var earningsFlags = []cli.Flag{
+	cli.StringFlag{Name: "date", Usage: "day to list (default today)"},
+	cli.StringFlag{Name: "from", Usage: "first day of a range to list"},
+	cli.StringFlag{Name: "to", Usage: "last day of a range to list (default --from)"},
+	cli.StringFlag{Name: "universe", Value: "sp500", Usage: "only companies in `NAME`, or all"},
+	cli.StringSliceFlag{Name: "ticker", Usage: "only these tickers, from any universe"},
+	formatFlag,
+}
+
+func parseEarnings(body string) ([]string, map[string]EarningEvent) {
+	matches := tickerPattern.FindAllStringSubmatchIndex(body, -1)
+	tickers := []string{}
+	events := make(map[string]EarningEvent)
+	for i, match := range matches {
+		ticker := body[match[2]:match[3]]
+		tickers = append(tickers, ticker)
+		end := len(body)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		text := body[match[1]:end]
+		e := events[ticker]
+		if t := timingPattern.FindString(text); t != "" && e.Timing == "" {
+			e.Timing = normalizeTiming(t)
+		}
+		if m := estimatePattern.FindStringSubmatch(text); m != nil && !e.HasEstimate {
+			e.Estimate, _ = strconv.ParseFloat(m[1], 64)
+			e.HasEstimate = true
+		}
+		events[ticker] = e
+	}
+	return tickers, events
+}
+
+func normalizeTiming(t string) string {
+	t = strings.ToLower(t)
+	switch {
+	case strings.HasPrefix(t, "before"), strings.HasPrefix(t, "pre"), t == "bmo":
+		return timingBefore
+	case strings.HasPrefix(t, "after"), strings.HasPrefix(t, "post"), t == "amc":
+		return timingAfter
+	}
+	return timingDuring
+}
+
+// reactionDate is the session that trades on the news of a release on date:
+// the next one if it came after the close.
+func reactionDate(date time.Time, timing string) time.Time {
+	if timing == timingAfter {
+		return SessionOffset(date, 1)
+	}
+	return SessionOffset(date, 0)
+}
+
+func earnings(c *cli.Context) error {
+	format := c.String("format")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	dates, err := earningsDates(c)
+	if err != nil {
+		return err
+	}
+	tickers := make(map[string]bool)
+	for _, t := range c.StringSlice("ticker") {
+		tickers[strings.ToUpper(t)] = true
+	}
+	var members *Membership
+	if len(tickers) == 0 && c.String("universe") != "all" {
+		if members, err = loadMembership(c.String("universe")); err != nil {
+			return err
+		}
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	records := []record{}
+	for _, date := range dates {
+		e, err := fetchEarnings(ctx, date, members)
+		if err != nil {
+			return err
+		}
+		if len(tickers) > 0 {
+			kept := []string{}
+			for _, t := range e.Stocks {
+				if tickers[t] {
+					kept = append(kept, t)
+				}
+			}
+			e.Stocks = kept
+		}
+		records = append(records, earningRecords(e)...)
+	}
+	return printRecords(format, records)
+}
+
+// earningsDates are the days asked for with --date or --from and --to.
+func earningsDates(c *cli.Context) ([]time.Time, error) {
+	if c.String("from") == "" {
+		if c.String("to") != "" {
+			return nil, fmt.Errorf("--to needs --from")
+		}
+		if c.String("date") == "" {
+			return []time.Time{midnight(time.Now())}, nil
+		}
+		date, err := parseDate(c.String("date"))
+		return []time.Time{date}, err
+	}
+	if c.String("date") != "" {
+		return nil, fmt.Errorf("use either --date or --from and --to")
+	}
+	from, err := parseDate(c.String("from"))
+	if err != nil {
+		return nil, err
+	}
+	to := from
+	if c.String("to") != "" {
+		if to, err = parseDate(c.String("to")); err != nil {
+			return nil, err
+		}
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("--to is before --from")
+	}
+	return Sessions(from, to.AddDate(0, 0, 1)), nil
+}
+
+func earningRecords(e EarningDate) []record {
+	records := []record{}
+	for _, ticker := range e.Stocks {
+		event := e.Events[ticker]
+		records = append(records, record{
+			{"date", dateKey(e.Date)},
+			{"ticker", ticker},
+			{"timing", event.Timing},
+			{"eps_estimate", estimate(event)},
+		})
+	}
+	return records
+}
+
+// estimate is the EPS estimate of e, or nil if there is none.
+func estimate(e EarningEvent) interface{} {
+	if !e.HasEstimate {
+		return nil
+	}
+	return e.Estimate
+}
+
+// earningsHistory lists every cached release of a ticker with the open to
+// close change on the session that reacted to it, from the quote cache.
+func earningsHistory(c *cli.Context) error {
+	format := c.String("format")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: earnings history TICKER")
+	}
+	ticker := strings.ToUpper(c.Args().First())
+	files, err := ioutil.ReadDir("earningdate")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	file := quoteFile(ticker)
+	quotes, err := loadQuotes(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	records, stale := []record{}, 0
+	for _, f := range files {
+		date, err := time.ParseInLocation(dateLayout, f.Name(), exchangeTZ)
+		if err != nil {
+			continue
+		}
+		e := new(EarningDate)
+		path := filepath.Join("earningdate", f.Name())
+		if err := Load(path, e); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if e.Version < earningsVersion {
+			stale++
+		}
+		if !containsTicker(e.Stocks, ticker) {
+			continue
+		}
+		event := e.Events[ticker]
+		react := reactionDate(date, event.Timing)
+		var change, closePrice interface{}
+		if q, ok := quotes.quote(dateKey(react)); ok {
+			change, closePrice = q.Change, q.Close
+		}
+		records = append(records, record{
+			{"date", dateKey(date)},
+			{"ticker", ticker},
+			{"timing", event.Timing},
+			{"eps_estimate", estimate(event)},
+			{"reaction_date", dateKey(react)},
+			{"reaction", change},
+			{"close", closePrice},
+		})
+	}
+	warnStaleEarnings(stale)
+	sort.SliceStable(records, func(i, j int) bool { return records[i][0].Value.(string) < records[j][0].Value.(string) })
+	return printRecords(format, records)
+}
+
+func containsTicker(tickers []string, ticker string) bool {
+	for _, t := range tickers {
+		if t == ticker {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEarnings(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		body    string
+		tickers []string
+		events  map[string]EarningEvent
+	}{
+		{"empty", `{"events":[]}`, []string{}, map[string]EarningEvent{}},
+		{
+			"timings and estimates",
+			`[{"url":"/companies/security/AAA:US","time":"Before Market Open","epsEstimate":"1.25"},` +
+				`{"url":"/companies/security/BB:US","time":"after-close","eps_estimate": -0.1},` +
+				`{"url":"/companies/security/CCCC:US","time":"during market"}]`,
+			[]string{"AAA", "BB", "CCCC"},
+			map[string]EarningEvent{
+				"AAA":  {Timing: timingBefore, Estimate: 1.25, HasEstimate: true},
+				"BB":   {Timing: timingAfter, Estimate: -0.1, HasEstimate: true},
+				"CCCC": {Timing: timingDuring},
+			},
+		},
+		{
+			// the timing of one company isn't taken for the one before it
+			"fields stay with their company",
+			`/companies/security/AAA:US nothing known /companies/security/BBB:US amc`,
+			[]string{"AAA", "BBB"},
+			map[string]EarningEvent{"AAA": {}, "BBB": {Timing: timingAfter}},
+		},
+		{
+			"listed twice keeps the first",
+			`/companies/security/AAA:US bmo EPS estimate: 2 /companies/security/AAA:US amc EPS estimate: 3`,
+			[]string{"AAA", "AAA"},
+			map[string]EarningEvent{"AAA": {Timing: timingBefore, Estimate: 2, HasEstimate: true}},
+		},
+		{"not US", `/companies/security/AAA:LN bmo`, []string{}, map[string]EarningEvent{}},
+	} {
+		tickers, events := parseEarnings(c.body)
+		if !reflect.DeepEqual(tickers, c.tickers) || !reflect.DeepEqual(events, c.events) {
+			t.Errorf("%s: parseEarnings = %v, %+v, want %v, %+v", c.name, tickers, events, c.tickers, c.events)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Backtests of several strategies share one pass over the sessions. For
+// each session the pass loads the earnings calendar and the quotes of every
+// ticker any of the strategies looks at once, then trades each strategy on
+// them in its own goroutine, with its own account. Lookups under the
+// session's context are answered from what the pass loaded, so a sweep of
+// dozens of strategies reads each cache file about as often as one does.
+
+// runner is a strategy and its account in a pass.
+type runner struct {
+	Strategy Strategy
+	Account  *Account
+	Start    time.Time // of its window
+	From     time.Time // first session to trade, later when resumed
+	Err      error     // why it stopped trading, if it did
+
+	ctx     context.Context // carries its progress
+	p       *perturbation
+	members *Membership
+	failed  bool   // Err is its own failure rather than ctx ending
+	stop    func() // if set, called when it fails
+}
+
+// fail stops r trading with err.
+func (r *runner) fail(err error) {
+	failAll([]*runner{r}, err)
+}
+
+// failAll stops the runners still trading with err, all before any of them
+// stops the others.
+func failAll(runners []*runner, err error) {
+	for _, r := range runners {
+		if r.Err == nil {
+			r.Err, r.failed = err, r.ctx.Err() == nil
+		}
+	}
+	for _, r := range runners {
+		if r.failed && r.stop != nil {
+			r.stop()
+		}
+	}
+}
+
+func newRunner(ctx context.Context, s Strategy, acct *Account, from time.Time, p *perturbation) *runner {
+	return &runner{Strategy: s, Account: acct, Start: from, From: from, ctx: ctx, p: p}
+}
+
+// session is what a pass loaded for one session: the whole earnings
+// calendar of the day and the quotes of the tickers the strategies look at.
+type session struct {
+	Date     time.Time
+	Earnings EarningDate
+	Quotes   map[string]*Quotes
+}
+
+type sessionKey struct{}
+
+func withSession(ctx context.Context, d *session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, d)
+}
+
+func sessionFrom(ctx context.Context) *session {
+	d, _ := ctx.Value(sessionKey{}).(*session)
+	return d
+}
+
+// quote looks up the bar of ticker on date in what the pass loaded. known is
+// false if the pass didn't settle it and it has to come from the cache.
+func (d *session) quote(ticker string, date time.Time) (q Quote, ok, known bool) {
+	if d == nil {
+		return Quote{}, false, false
+	}
+	quotes, loaded := d.Quotes[ticker]
+	if !loaded {
+		return Quote{}, false, false
+	}
+	key := dateKey(date)
+	if q, ok := quotes.quote(key); ok {
+		return q, true, true
+	}
+	// the pass already fetched what there is for its own session
+	return Quote{}, false, quotes.Missing[key] || key == dateKey(d.Date)
+}
+
+// pass trades the runners on every session from start up to end, each from
+// its From on. A runner that fails, or needs data that can't be loaded,
+// stops trading with its Err set while the others go on; pass itself only
+// fails if ctx is done or the metadata can't be loaded.
+func pass(ctx context.Context, runners []*runner, start, end time.Time) error {
+	if _, err := loadMetadata(); err != nil {
+		return err
+	}
+	for _, r := range runners {
+		if r.members == nil && r.Err == nil {
+			members, err := loadMembership(r.Strategy.Index)
+			if err != nil {
+				r.fail(err)
+			}
+			r.members = members
+		}
+	}
+	for _, i := range Sessions(start, end) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		active := []*runner{}
+		for _, r := range runners {
+			if r.Err == nil && !i.Before(r.From) {
+				active = append(active, r)
+			}
+		}
+		if len(active) == 0 {
+			continue
+		}
+		d := loadSession(ctx, i, active)
+		var wg sync.WaitGroup
+		for _, r := range active {
+			if r.Err != nil {
+				continue
+			}
+			wg.Add(1)
+			go func(r *runner) {
+				defer wg.Done()
+				defer func() {
+					if p := recover(); p != nil {
+						r.fail(fmt.Errorf("panic: %v", p))
+					}
+				}()
+				if err := r.trade(withSession(r.ctx, d), i); err != nil {
+					r.fail(err)
+				}
+			}(r)
+		}
+		wg.Wait()
+	}
+	return nil
+}
+
+func (r *runner) trade(ctx context.Context, i time.Time) error {
+	if _, err := fillOrders(ctx, r.Account, i); err != nil {
+		return err
+	}
+	if err := tradeDay(ctx, r.Strategy, r.Account, r.members, i, r.p); err != nil {
+		return err
+	}
+	r.Account.Through = i
+	r.Account.Equity = append(r.Account.Equity, r.Account.value())
+	progressFrom(ctx).update(r.Account, i)
+	return nil
+}
+
+// loadSession loads the earnings calendar of session i and the quotes of
+// the companies on it that the runners trade, and of their resting orders,
+// fetching what the cache misses. What can't be loaded fails only the
+// runners that need it.
+func loadSession(ctx context.Context, i time.Time, runners []*runner) *session {
+	e, err := fetchEarnings(ctx, i, nil)
+	if err != nil {
+		failAll(runners, err)
+		return nil
+	}
+	d := &session{Date: i, Earnings: e, Quotes: make(map[string]*Quotes)}
+	needs, ranges := make(map[string][]*runner), make(map[string]bool)
+	for _, r := range runners {
+		for _, ticker := range filterEarnings(e.Stocks, r.members, i) {
+			needs[ticker] = append(needs[ticker], r)
+		}
+		for _, o := range r.Account.Orders {
+			if i.After(o.Date) {
+				needs[o.Ticker] = append(needs[o.Ticker], r)
+				ranges[o.Ticker] = ranges[o.Ticker] || o.Type == orderLimit
+			}
+		}
+	}
+	for ticker, rs := range needs {
+		q, err := sessionQuotes(ctx, ticker, i, ranges[ticker])
+		if err != nil {
+			failAll(rs, err)
+			continue
+		}
+		d.Quotes[ticker] = q
+	}
+	return d
+}
+
+// sessionQuotes loads the quotes of ticker once the cache has the bar of
+// session i, with its range if withRange is set, or knows there is none.
+func sessionQuotes(ctx context.Context, ticker string, i time.Time, withRange bool) (*Quotes, error) {
+	file := quoteFile(ticker)
+	q, err := loadQuotes(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	key := dateKey(i)
+	if bar, ok := q.quote(key); (ok && (bar.HasRange || !withRange)) || q.Missing[key] {
+		return q, nil
+	}
+	fetch := quoteForDate
+	if withRange {
+		fetch = barForDate
+	}
+	if _, _, err := fetch(ctx, ticker, i); err != nil {
+		return nil, err
+	}
+	if q, err = loadQuotes(file); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return q, nil
+}
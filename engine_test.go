@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// TestPassMatchesSeparateRuns checks that strategies backtested together in
+// one pass over shared session data trade as they do on their own.
+func TestPassMatchesSeparateRuns(t *testing.T) {
+	inTempDir(t)
+	start, end := day(t, "2021-01-04"), day(t, "2021-04-01")
+	writeMarket(t, start, end, "AAA", "BBB", "CCC", "DDD", "EEE")
+	base := Strategy{Index: "mkt", ThresholdPct: 0.02, StartCash: 10000, Increment: 1000}
+	strategies := []Strategy{}
+	for _, change := range []func(s *Strategy){
+		func(s *Strategy) {},
+		func(s *Strategy) { s.ThresholdPct = 0.04 },
+		func(s *Strategy) { s.EntryOrder, s.ExitOrder = orderClose, orderClose },
+		func(s *Strategy) { s.EntryOrder, s.LimitPct, s.LimitDays = orderLimit, 0.01, 2 },
+		func(s *Strategy) { s.IncrementPct, s.MaxSectorPct = 0.3, 0.5 },
+	} {
+		s := base
+		change(&s)
+		strategies = append(strategies, s)
+	}
+	ctx := context.Background()
+
+	alone := []*Account{}
+	for _, s := range strategies {
+		acct := newAccount(s.StartCash)
+		if err := backtest(ctx, s, acct, start, end, nil); err != nil {
+			t.Fatal(err)
+		}
+		alone = append(alone, acct)
+	}
+	runners := []*runner{}
+	for _, s := range strategies {
+		runners = append(runners, newRunner(ctx, s, newAccount(s.StartCash), start, nil))
+	}
+	if err := pass(ctx, runners, start, end); err != nil {
+		t.Fatal(err)
+	}
+	for k, r := range runners {
+		if r.Err != nil {
+			t.Fatalf("strategy %d: %v", k, r.Err)
+		}
+		got := Strategy{Total: r.Account.Cash, Ledger: r.Account.Ledger, Equity: r.Account.Equity}
+		want := Strategy{Total: alone[k].Cash, Ledger: alone[k].Ledger, Equity: alone[k].Equity}
+		if len(want.Ledger) == 0 {
+			t.Errorf("strategy %d traded nothing", k)
+		}
+		if !sameResult(got, want) {
+			t.Errorf("strategy %d made %d trades in the pass, %d on its own", k, len(got.Ledger), len(want.Ledger))
+		}
+	}
+}
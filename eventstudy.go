@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Event studies of the earnings calendar. For each event the market model
+// R = alpha + beta*Rm is fitted by least squares to the daily returns of the
+// stock and a benchmark over an estimation window before the report, and the
+// abnormal returns over the event window are the returns less what the model
+// expects from the benchmark. Windows are in sessions relative to the
+// reaction session, day 0. Across events the abnormal returns are averaged
+// (AAR) and cumulated (CAAR), with confidence intervals from the spread of
+// the events' cumulative abnormal returns.
+
+var eventStudyFlags = append([]cli.Flag{
+	cli.StringFlag{Name: "benchmark", Value: "SPY", Usage: "ticker of the market the returns are measured against"},
+	cli.StringFlag{Name: "estimation", Value: "-250,-30", Usage: "first and last session of the estimation window"},
+	cli.StringFlag{Name: "window", Value: "-5,20", Usage: "first and last session of the event window"},
+	cli.IntFlag{Name: "min-estimation", Value: 120, Usage: "fewest sessions in the estimation window with returns of both the stock and the benchmark to fit an event"},
+	cli.Float64Flag{Name: "confidence", Value: 0.95, Usage: "level of the confidence intervals"},
+	cli.BoolFlag{Name: "events", Usage: "list every event with its fit and CAR rather than the averages"},
+}, eventFlags...)
+
+// studyWindow is a span of sessions relative to day 0, both ends included.
+type studyWindow struct {
+	From, To int
+}
+
+func (w studyWindow) String() string {
+	return fmt.Sprintf("%+d..%+d", w.From, w.To)
+}
+
+func parseWindow(s string) (studyWindow, error) {
+	ends, err := parseNumbers(s)
+	if err != nil {
+		return studyWindow{}, err
+	}
+	if len(ends) != 2 || ends[0] != math.Trunc(ends[0]) || ends[1] != math.Trunc(ends[1]) || ends[0] > ends[1] {
+		return studyWindow{}, fmt.Errorf("%q is not FIRST,LAST in sessions", s)
+	}
+	return studyWindow{int(ends[0]), int(ends[1])}, nil
+}
+
+// eventFit is the market model of one event and its abnormal returns over
+// the event window.
+type eventFit struct {
+	calendarEvent
+	Alpha, Beta, Sigma float64
+	Estimation         int // returns the model was fitted to
+	AR                 []float64
+}
+
+// CAR is the cumulative abnormal return over the event window.
+func (f eventFit) CAR() float64 {
+	car := 0.0
+	for _, ar := range f.AR {
+		car += ar
+	}
+	return car
+}
+
+// sessionReturns are the close to close returns of q on sessions[1:], NaN
+// where a close is missing.
+func sessionReturns(q *Quotes, sessions []time.Time) []float64 {
+	returns := make([]float64, len(sessions)-1)
+	for i := range returns {
+		prev, ok0 := q.ClosePrices[dateKey(sessions[i])]
+		cur, ok1 := q.ClosePrices[dateKey(sessions[i+1])]
+		returns[i] = math.NaN()
+		if ok0 && ok1 && prev > 0 {
+			returns[i] = cur/prev - 1
+		}
+	}
+	return returns
+}
+
+// relativeSessions lists the sessions from day0+from up to day0+to.
+func relativeSessions(day0 time.Time, from, to int) []time.Time {
+	start, end := SessionOffset(day0, from), SessionOffset(day0, to)
+	return Sessions(start, end.AddDate(0, 0, 1))
+}
+
+// marketModel fits stock = alpha + beta*market by least squares over the
+// pairs where both are known, with sigma the standard error of the fit.
+func marketModel(stock, market []float64) (alpha, beta, sigma float64, n int) {
+	var sx, sy float64
+	for i := range stock {
+		if !math.IsNaN(stock[i]) && !math.IsNaN(market[i]) {
+			sx += market[i]
+			sy += stock[i]
+			n++
+		}
+	}
+	if n < 3 {
+		return 0, 0, 0, n
+	}
+	mx, my := sx/float64(n), sy/float64(n)
+	var sxx, sxy float64
+	for i := range stock {
+		if !math.IsNaN(stock[i]) && !math.IsNaN(market[i]) {
+			sxx += (market[i] - mx) * (market[i] - mx)
+			sxy += (market[i] - mx) * (stock[i] - my)
+		}
+	}
+	if sxx > 0 {
+		beta = sxy / sxx
+	}
+	alpha = my - beta*mx
+	var ssr float64
+	for i := range stock {
+		if !math.IsNaN(stock[i]) && !math.IsNaN(market[i]) {
+			e := stock[i] - alpha - beta*market[i]
+			ssr += e * e
+		}
+	}
+	return alpha, beta, math.Sqrt(ssr / float64(n-2)), n
+}
+
+// fitEvent fits the market model of e over est and works out its abnormal
+// returns over win. ok is false if the estimation window has fewer than
+// minEst returns or the event window misses any.
+func fitEvent(e calendarEvent, q, bench *Quotes, est, win studyWindow, minEst int) (eventFit, bool) {
+	day0 := e.Reaction()
+	// each return needs the close of the session before
+	estSessions := relativeSessions(day0, est.From-1, est.To)
+	winSessions := relativeSessions(day0, win.From-1, win.To)
+	f := eventFit{calendarEvent: e}
+	f.Alpha, f.Beta, f.Sigma, f.Estimation = marketModel(sessionReturns(q, estSessions), sessionReturns(bench, estSessions))
+	if f.Estimation < minEst {
+		return f, false
+	}
+	stock, market := sessionReturns(q, winSessions), sessionReturns(bench, winSessions)
+	for i := range stock {
+		if math.IsNaN(stock[i]) || math.IsNaN(market[i]) {
+			return f, false
+		}
+		f.AR = append(f.AR, stock[i]-f.Alpha-f.Beta*market[i])
+	}
+	return f, true
+}
+
+// meanInterval is the mean of values with its confidence interval at level
+// under a normal approximation, and the t statistic.
+func meanInterval(values []float64, level float64) (mean, low, high, t float64) {
+	n := float64(len(values))
+	for _, v := range values {
+		mean += v
+	}
+	mean /= n
+	if len(values) < 2 {
+		return mean, math.NaN(), math.NaN(), math.NaN()
+	}
+	var ss float64
+	for _, v := range values {
+		ss += (v - mean) * (v - mean)
+	}
+	se := math.Sqrt(ss/(n-1)) / math.Sqrt(n)
+	z := math.Sqrt2 * math.Erfinv(level)
+	return mean, mean - z*se, mean + z*se, mean / se
+}
+
+// optional is v for a record, or empty if it is not a number.
+func optional(v float64) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return round4(v)
+}
+
+func analyzeEvents(c *cli.Context) error {
+	format := c.String("format")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	est, err := parseWindow(c.String("estimation"))
+	if err != nil {
+		return fmt.Errorf("--estimation: %v", err)
+	}
+	win, err := parseWindow(c.String("window"))
+	if err != nil {
+		return fmt.Errorf("--window: %v", err)
+	}
+	if est.To >= win.From {
+		return fmt.Errorf("the estimation window %s has to end before the event window %s", est, win)
+	}
+	level := c.Float64("confidence")
+	if level <= 0 || level >= 1 {
+		return fmt.Errorf("--confidence %g is not between 0 and 1", level)
+	}
+	events, err := calendarEvents(c)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("no events")
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	quotes, err := eventQuotes(ctx, events, 1-est.From, win.To, c.Bool("cache-only"))
+	if err != nil {
+		return err
+	}
+	// the benchmark spans every event, reaction sessions included
+	benchmark := strings.ToUpper(c.String("benchmark"))
+	first, last := events[0], events[len(events)-1]
+	first.Ticker, last.Ticker = benchmark, benchmark
+	benchQuotes, err := eventQuotes(ctx, []calendarEvent{first, last}, 1-est.From, win.To, c.Bool("cache-only"))
+	if err != nil {
+		return err
+	}
+	bench := benchQuotes[benchmark]
+
+	fits := []eventFit{}
+	for _, e := range events {
+		if f, ok := fitEvent(e, quotes[e.Ticker], bench, est, win, c.Int("min-estimation")); ok {
+			fits = append(fits, f)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d events have the quotes for estimation %s and window %s\n", len(fits), len(events), est, win)
+	if len(fits) == 0 {
+		return fmt.Errorf("no events to study")
+	}
+
+	records := []record{}
+	if c.Bool("events") {
+		for _, f := range fits {
+			var ar0 interface{}
+			if win.From <= 0 && win.To >= 0 {
+				ar0 = optional(f.AR[-win.From])
+			}
+			records = append(records, record{
+				{"date", dateKey(f.Date)},
+				{"ticker", f.Ticker},
+				{"reaction_date", dateKey(f.Reaction())},
+				{"alpha", optional(f.Alpha)},
+				{"beta", optional(f.Beta)},
+				{"sigma", optional(f.Sigma)},
+				{"estimation", f.Estimation},
+				{"ar_0", ar0},
+				{"car", optional(f.CAR())},
+			})
+		}
+		return printRecords(format, records)
+	}
+	cars := make([]float64, len(fits))
+	for k := range fits[0].AR {
+		ars := make([]float64, len(fits))
+		for i, f := range fits {
+			ars[i] = f.AR[k]
+			cars[i] += f.AR[k]
+		}
+		aar, _, _, _ := meanInterval(ars, level)
+		caar, low, high, t := meanInterval(cars, level)
+		records = append(records, record{
+			{"day", win.From + k},
+			{"events", len(fits)},
+			{"aar", optional(aar)},
+			{"caar", optional(caar)},
+			{"caar_low", optional(low)},
+			{"caar_high", optional(high)},
+			{"t", optional(t)},
+		})
+	}
+	return printRecords(format, records)
+}
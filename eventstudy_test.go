@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMarketModel(t *testing.T) {
+	nan := math.NaN()
+	for _, c := range []struct {
+		name               string
+		stock, market      []float64
+		alpha, beta, sigma float64
+		n                  int
+	}{
+		{"exact", []float64{0.021, 0.041, -0.019, 0.061}, []float64{0.01, 0.02, -0.01, 0.03}, 0.001, 2, 0, 4},
+		{"noise", []float64{1, 3, 2}, []float64{1, 2, 3}, 1, 0.5, math.Sqrt(1.5), 3},
+		{"only where both are known", []float64{1, nan, 3, 2, 5}, []float64{1, 4, 2, 3, nan}, 1, 0.5, math.Sqrt(1.5), 3},
+		{"flat market", []float64{1, 2, 3}, []float64{1, 1, 1}, 2, 0, math.Sqrt2, 3},
+		{"too few", []float64{1, 2, nan}, []float64{1, 2, 3}, 0, 0, 0, 2},
+	} {
+		alpha, beta, sigma, n := marketModel(c.stock, c.market)
+		if !near(alpha, c.alpha) || !near(beta, c.beta) || !near(sigma, c.sigma) || n != c.n {
+			t.Errorf("%s: marketModel = %g, %g, %g, %d, want %g, %g, %g, %d", c.name, alpha, beta, sigma, n, c.alpha, c.beta, c.sigma, c.n)
+		}
+	}
+}
+
+func TestMeanInterval(t *testing.T) {
+	se := 1 / math.Sqrt(3)
+	z := 1.959963984540054
+	for _, c := range []struct {
+		values              []float64
+		level               float64
+		mean, low, high, tt float64
+	}{
+		{[]float64{1, 2, 3}, 0.95, 2, 2 - z*se, 2 + z*se, 2 / se},
+		{[]float64{-1, 0, 1}, 0.95, 0, -z * se, z * se, 0},
+		{[]float64{4}, 0.95, 4, math.NaN(), math.NaN(), math.NaN()},
+	} {
+		mean, low, high, tt := meanInterval(c.values, c.level)
+		if !near(mean, c.mean) || !near(low, c.low) || !near(high, c.high) || !near(tt, c.tt) {
+			t.Errorf("meanInterval(%v) = %g, %g, %g, %g, want %g, %g, %g, %g", c.values, mean, low, high, tt, c.mean, c.low, c.high, c.tt)
+		}
+	}
+}
+
+func TestSessionReturns(t *testing.T) {
+	q := &Quotes{ClosePrices: map[string]float64{"2018-07-02": 10, "2018-07-03": 11, "2018-07-06": 12, "2018-07-09": 6}}
+	got := sessionReturns(q, Sessions(day(t, "2018-07-02"), day(t, "2018-07-10")))
+	want := []float64{0.1, math.NaN(), math.NaN(), -0.5}
+	if len(got) != len(want) {
+		t.Fatalf("sessionReturns = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !near(got[i], want[i]) {
+			t.Errorf("sessionReturns = %v, want %v", got, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/piquette/finance-go/chart"
+	"github.com/piquette/finance-go/datetime"
+)
+
+// Intraday bars are only fetched for the sessions a strategy looks at a
+// reporting company on, and are cached apart from the daily quotes in
+// intraday/<interval>/<ticker>, keyed by date. Yahoo serves 1m bars for the
+// last 30 days and 5m and 15m ones for the last 60, so older sessions only
+// have bars if they were cached while they were recent.
+//
+// A strategy with an EntryInterval buys in the session itself: it watches
+// the bars from EntryAfter up to EntryUntil minutes after the open and
+// enters on the first whose open is more than ThresholdPct below the
+// previous close, filling at that bar's close. With EntryUntil unset only
+// the bar at EntryAfter is looked at.
+
+const intradayDir = "intraday"
+
+var intervals = map[string]datetime.Interval{
+	"1m":  datetime.OneMin,
+	"5m":  datetime.FiveMins,
+	"15m": datetime.FifteenMins,
+}
+
+type Bar struct {
+	Time   time.Time // start of the bar
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int
+}
+
+type IntradayQuotes struct {
+	Ticker   string
+	Interval string
+	Bars     map[string][]Bar
+	Missing  map[string]bool
+}
+
+func intradayFile(interval, ticker string) string {
+	return filepath.Join(intradayDir, interval, ticker)
+}
+
+func loadIntraday(file string) (*IntradayQuotes, error) {
+	result := &IntradayQuotes{
+		Bars:    make(map[string][]Bar),
+		Missing: make(map[string]bool),
+	}
+	if _, err := os.Stat(file); err != nil {
+		return result, nil
+	}
+	if err := Load(file, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// intradayBars returns the bars of ticker in the session date, fetching and
+// caching them if needed. ok is false if there are none to be had.
+func intradayBars(ctx context.Context, ticker, interval string, date time.Time) ([]Bar, bool, error) {
+	iv, ok := intervals[interval]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown interval %q", interval)
+	}
+	file := intradayFile(interval, ticker)
+	defer lockFile(file)()
+	key := dateKey(date)
+	result, err := loadIntraday(file)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %v", file, err)
+	}
+	if bars, ok := result.Bars[key]; ok {
+		countCache(ctx, true)
+		return bars, true, nil
+	}
+	if result.Missing[key] || !sessionClosed(date) {
+		countCache(ctx, true)
+		return nil, false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	countCache(ctx, false)
+	start := midnight(date)
+	end := start.AddDate(0, 0, 1)
+	iter := chart.Get(&chart.Params{
+		Symbol:   ticker,
+		Interval: iv,
+		Start:    datetime.New(&start),
+		End:      datetime.New(&end),
+	})
+	open, closing := sessionOpen(date), SessionClose(date)
+	bars := []Bar{}
+	for iter.Next() {
+		b := iter.Bar()
+		t := time.Unix(int64(b.Timestamp), 0).In(exchangeTZ)
+		if b.Open.Sign() == 0 || t.Before(open) || !t.Before(closing) {
+			continue
+		}
+		bar := Bar{Time: t, Volume: b.Volume}
+		bar.Open, _ = b.Open.Float64()
+		bar.High, _ = b.High.Float64()
+		bar.Low, _ = b.Low.Float64()
+		bar.Close, _ = b.Close.Float64()
+		bars = append(bars, bar)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, false, fmt.Errorf("fetching %s %s bars: %v", ticker, interval, err)
+	}
+	result.Ticker, result.Interval = ticker, interval
+	if len(bars) == 0 {
+		result.Missing[key] = true
+	} else {
+		result.Bars[key] = bars
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, false, err
+	}
+	if err := Save(file, result); err != nil {
+		return nil, false, fmt.Errorf("%s: %v", file, err)
+	}
+	return bars, len(bars) > 0, nil
+}
+
+// sessionOpen is when trading starts on date.
+func sessionOpen(date time.Time) time.Time {
+	return midnight(date).Add(9*time.Hour + 30*time.Minute)
+}
+
+// intradayBuy enters ticker in session i if its bars give s the signal.
+func intradayBuy(ctx context.Context, s Strategy, acct *Account, members *Membership, ticker string, i time.Time, p *perturbation) error {
+	prev, ok, err := lastClose(ctx, ticker, PreviousSession(i))
+	if err != nil {
+		return err
+	}
+	var bars []Bar
+	if ok {
+		if bars, ok, err = intradayBars(ctx, ticker, s.EntryInterval, i); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		acct.Skipped++
+		return nil
+	}
+	bar, ok := intradayEntry(s, bars, prev.Close, i)
+	if !ok {
+		return nil
+	}
+	if _, drop := p.entryShift(false); drop {
+		return nil
+	}
+	shares := buyShares(s, acct, ticker, bar.Close)
+	if shares <= 0 {
+		return nil
+	}
+	length, _ := time.ParseDuration(s.EntryInterval)
+	if err := checkLookahead(ctx, s, members, i, bar.Time, bar.Time.Add(length), "buys "+ticker); err != nil {
+		return err
+	}
+	acct.apply(Trade{Date: i, Ticker: ticker, Action: "BUY", Shares: shares, Price: bar.Close})
+	return nil
+}
+
+// intradayEntry is the bar of session date that s enters on, if any, given
+// the previous close. The signal is known at the bar's open.
+func intradayEntry(s Strategy, bars []Bar, prevClose float64, date time.Time) (Bar, bool) {
+	from := sessionOpen(date).Add(time.Duration(s.EntryAfter) * time.Minute)
+	until := sessionOpen(date).Add(time.Duration(s.EntryUntil) * time.Minute)
+	if until.Before(from) {
+		until = from
+	}
+	for _, b := range bars {
+		if b.Time.Before(from) {
+			continue
+		}
+		if b.Time.After(until) {
+			break
+		}
+		if b.Open/prevClose-1 < -s.ThresholdPct {
+			return b, true
+		}
+	}
+	return Bar{}, false
+}
+
+// entryTiming is when the signal of an entry of s on session i is known and
+// the earliest the entry can trade.
+func entryTiming(s Strategy, i time.Time) (signal, at time.Time) {
+	if s.EntryInterval == "" {
+		return SessionClose(i), tradeTime(s.entryOrder(), i)
+	}
+	length, _ := time.ParseDuration(s.EntryInterval)
+	signal = sessionOpen(i).Add(time.Duration(s.EntryAfter) * time.Minute)
+	return signal, signal.Add(length)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntradayEntry(t *testing.T) {
+	date := day(t, "2021-03-01")
+	open := sessionOpen(date)
+	// 5m bars from the open, opening at these prices, the 9:50 one missing
+	bars := []Bar{}
+	for k, price := range []float64{97, 96, 94, 0, 93, 90} {
+		if price > 0 {
+			bars = append(bars, Bar{Time: open.Add(time.Duration(5*k) * time.Minute), Open: price, Close: price + 1})
+		}
+	}
+	for _, c := range []struct {
+		name         string
+		after, until int
+		want         string // time of the entry bar, "" for none
+	}{
+		{"first bar only", 0, 0, ""},
+		{"bar at EntryAfter only", 10, 0, "09:40"},
+		{"no bar at EntryAfter", 15, 0, ""}, // 9:45 is missing, 9:50 is too late
+		{"until is inclusive", 0, 10, "09:40"},
+		{"until is exclusive of the next", 0, 5, ""},
+		{"window after a gap", 15, 20, "09:50"},
+		{"after the last bar", 30, 60, ""},
+		{"until before after", 10, 5, "09:40"},
+	} {
+		s := Strategy{ThresholdPct: 0.05, EntryInterval: "5m", EntryAfter: c.after, EntryUntil: c.until}
+		b, ok := intradayEntry(s, bars, 100, date)
+		got := ""
+		if ok {
+			got = b.Time.In(exchangeTZ).Format("15:04")
+		}
+		if got != c.want {
+			t.Errorf("%s: entered at %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Strict mode checks that every trade of a backtest depends only on what was
+// known before the trade could happen. A decision relies on inputs that each
+// became known at some time: the close its signal is read from, the list the
+// universe comes from and the ticker metadata the sector rules use. A trade
+// at or before any of those fails the backtest with a lookaheadError. The
+// lookahead command runs the same checks over the window of each strategy,
+// without trading, and reports what would be flagged.
+
+type lookaheadError struct {
+	Feature string
+	Date    time.Time
+	Detail  string
+}
+
+func (e *lookaheadError) Error() string {
+	return fmt.Sprintf("lookahead on %s, %s: %s", dateKey(e.Date), e.Feature, e.Detail)
+}
+
+type strictKey struct{}
+
+// withStrict makes the backtests under ctx fail on lookahead.
+func withStrict(ctx context.Context) context.Context {
+	return context.WithValue(ctx, strictKey{}, true)
+}
+
+func isStrict(ctx context.Context) bool {
+	strict, _ := ctx.Value(strictKey{}).(bool)
+	return strict
+}
+
+// input is something a decision relies on and when it became known.
+type input struct {
+	Feature string
+	Known   time.Time
+	Detail  string
+}
+
+// decisionInputs are what a decision of s on the signal of session i relies
+// on, with the signal known at signal.
+func decisionInputs(s Strategy, members *Membership, i, signal time.Time) []input {
+	detail := fmt.Sprintf("the change on %s is known at its close", dateKey(i))
+	if !signal.Equal(SessionClose(i)) {
+		detail = fmt.Sprintf("the signal on %s is known at %s", dateKey(i), signal.Format("15:04"))
+	}
+	inputs := []input{{"same-bar fill", signal, detail}}
+	if members != nil {
+		if known := members.KnownAt(i); !known.IsZero() {
+			inputs = append(inputs, input{"static universe", known, fmt.Sprintf("%s on %s comes from a list of %s", s.Index, dateKey(i), dateKey(known))})
+		}
+	}
+	if usesSectors(s) && !metadataAsOf.IsZero() {
+		inputs = append(inputs, input{"current sectors", metadataAsOf, fmt.Sprintf("the sector rules use metadata written %s", dateKey(metadataAsOf))})
+	}
+	return inputs
+}
+
+func usesSectors(s Strategy) bool {
+	return len(s.IncludeSectors) > 0 || len(s.ExcludeSectors) > 0 || s.MaxSectorPct > 0
+}
+
+// tradeTime is the earliest an order of type typ placed on date can trade.
+func tradeTime(typ string, date time.Time) time.Time {
+	if typ == orderClose {
+		return SessionClose(date)
+	}
+	return SessionOffset(date, 1).Add(9*time.Hour + 30*time.Minute)
+}
+
+// checkLookahead fails in strict mode if a trade at at relies on something
+// about the signal of session i that wasn't known before it.
+func checkLookahead(ctx context.Context, s Strategy, members *Membership, i, signal, at time.Time, what string) error {
+	if !isStrict(ctx) {
+		return nil
+	}
+	for _, in := range decisionInputs(s, members, i, signal) {
+		if !in.Known.Before(at) {
+			detail := fmt.Sprintf("%s at %s, but %s", what, at.Format("2006-01-02 15:04"), in.Detail)
+			return &lookaheadError{Feature: in.Feature, Date: i, Detail: detail}
+		}
+	}
+	return nil
+}
+
+var lookaheadFlags = []cli.Flag{
+	cli.StringFlag{Name: "strategy", Usage: "only the named strategy (default all)"},
+	formatFlag,
+}
+
+// flagged counts the sessions a feature of a strategy is flagged on.
+type flagged struct {
+	Feature     string
+	Side        string
+	Sessions    int
+	First, Last time.Time
+	Detail      string
+}
+
+// lookahead reports which features of the strategies simulate --strict
+// would fail on, and on how many sessions of their windows.
+func lookahead(c *cli.Context) error {
+	format := c.String("format")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	chosen := strategies
+	if c.String("strategy") != "" {
+		s, err := findStrategy(c.String("strategy"))
+		if err != nil {
+			return err
+		}
+		chosen = []Strategy{s}
+	}
+	if _, err := loadMetadata(); err != nil {
+		return err
+	}
+	records := []record{}
+	for _, s := range chosen {
+		members, err := loadMembership(s.Index)
+		if err != nil {
+			return err
+		}
+		found := lookaheadFeatures(s, members, yearsAgo(s.NumYears), time.Now())
+		if len(found) == 0 && format == "table" {
+			fmt.Printf("%s: nothing flagged\n", s.Name)
+		}
+		for _, f := range found {
+			records = append(records, record{
+				{"strategy", s.Name},
+				{"feature", f.Feature},
+				{"side", f.Side},
+				{"sessions", f.Sessions},
+				{"first", dateKey(f.First)},
+				{"last", dateKey(f.Last)},
+				{"detail", f.Detail},
+			})
+		}
+	}
+	if len(records) == 0 && format == "table" {
+		return nil
+	}
+	return printRecords(format, records)
+}
+
+// lookaheadFeatures checks the entries and exits of s on every session from
+// start up to end as if each had a signal.
+func lookaheadFeatures(s Strategy, members *Membership, start, end time.Time) []flagged {
+	found := []flagged{}
+	index := make(map[string]int)
+	for _, i := range Sessions(start, end) {
+		for _, side := range []string{"entry", "exit"} {
+			signal, at := SessionClose(i), tradeTime(s.exitOrder(), i)
+			if side == "entry" {
+				signal, at = entryTiming(s, i)
+			}
+			for _, in := range decisionInputs(s, members, i, signal) {
+				if in.Known.Before(at) {
+					continue
+				}
+				key := in.Feature + "/" + side
+				n, ok := index[key]
+				if !ok {
+					n = len(found)
+					index[key] = n
+					found = append(found, flagged{Feature: in.Feature, Side: side, First: i})
+				}
+				found[n].Sessions++
+				found[n].Last = i
+				found[n].Detail = in.Detail
+			}
+		}
+	}
+	return found
+}
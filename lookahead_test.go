@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckLookahead(t *testing.T) {
+	inTempDir(t)
+	writeTestFile(t, "universes/late/2021-06-01.txt", "AAA\n")
+	late, err := loadMembership("late")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict := withStrict(context.Background())
+	i := day(t, "2021-03-01")
+	at := func(session time.Time, hour, min int) time.Time {
+		return session.Add(time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute)
+	}
+	for _, c := range []struct {
+		name    string
+		ctx     context.Context
+		s       Strategy
+		members *Membership
+		i       time.Time
+		signal  time.Time
+		at      time.Time
+		feature string
+	}{
+		{"next open", strict, Strategy{}, nil, i, SessionClose(i), tradeTime(orderOpen, i), ""},
+		{"same close", strict, Strategy{}, nil, i, SessionClose(i), tradeTime(orderClose, i), "same-bar fill"},
+		{"before the close", strict, Strategy{}, nil, i, SessionClose(i), at(i, 10, 0), "same-bar fill"},
+		{"not strict", context.Background(), Strategy{}, nil, i, SessionClose(i), tradeTime(orderClose, i), ""},
+		{"intraday bar after", strict, Strategy{}, nil, i, at(i, 10, 30), at(i, 10, 35), ""},
+		{"intraday same bar", strict, Strategy{}, nil, i, at(i, 10, 30), at(i, 10, 30), "same-bar fill"},
+		{"list published later", strict, Strategy{Index: "late"}, late, i, SessionClose(i), tradeTime(orderOpen, i), "static universe"},
+		{"list published before", strict, Strategy{Index: "late"}, late, day(t, "2021-07-01"), SessionClose(day(t, "2021-07-01")), tradeTime(orderOpen, day(t, "2021-07-01")), ""},
+	} {
+		err := checkLookahead(c.ctx, c.s, c.members, c.i, c.signal, c.at, "buys AAA")
+		var la *lookaheadError
+		switch {
+		case c.feature == "" && err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		case c.feature != "" && !errors.As(err, &la):
+			t.Errorf("%s: got %v, want a lookahead on %s", c.name, err, c.feature)
+		case c.feature != "" && la.Feature != c.feature:
+			t.Errorf("%s: lookahead on %s, want %s", c.name, la.Feature, c.feature)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Point-in-time index membership. The history for an index lives in
+// constituents/<index>.csv with one row per membership span:
+//
+//	ticker,added,removed
+//	AAPL,1982-11-30,
+//	XYZ,2004-06-25,2012-11-16
+//
+// An empty added date means the ticker was a member since before the file
+// starts, an empty removed date means it still is. Without a history file the
+// universe snapshots in universes/<index>/ are used, which only contain the
+// companies that were still around when the snapshot was taken.
+
+const dateLayout = "2006-01-02"
+
+type span struct {
+	Added   time.Time
+	Removed time.Time
+}
+
+type Membership struct {
+	Name string
+}
+
+// Delisting records when a ticker stopped trading and, if known, the price
+// holders were cashed out at.
+type Delisting struct {
+	Date  time.Time
+	Price float64
+}
+
+var (
+	membershipMu sync.RWMutex
+	histories    = make(map[string]map[string][]span)
+	delistings   map[string]Delisting
+	warnedStatic = make(map[string]bool)
+)
+
+// loadMembership loads the history or universe files for name and for every
+// universe it references.
+func loadMembership(name string) (*Membership, error) {
+	membershipMu.Lock()
+	defer membershipMu.Unlock()
+	if err := loadUniverseClosure(name, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	if !pointInTime(name) && !warnedStatic[name] {
+		warnedStatic[name] = true
+		fmt.Fprintf(os.Stderr, "warning: no constituents history for %s, using universe snapshots that leave out companies no longer in it\n", name)
+	}
+	return &Membership{Name: name}, nil
+}
+
+// loadHistory reads constituents/<name>.csv, returning false if there is none.
+func loadHistory(name string) (bool, error) {
+	if _, ok := histories[name]; ok {
+		return true, nil
+	}
+	file := fmt.Sprintf("constituents/%s.csv", name)
+	rows, err := readCSV(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	spans := make(map[string][]span)
+	for i, row := range rows {
+		if len(row) < 2 {
+			return false, fmt.Errorf("%s:%d: expected ticker,added,removed", file, i+1)
+		}
+		var sp span
+		if sp.Added, err = parseDate(row[1]); err != nil {
+			return false, fmt.Errorf("%s:%d: %v", file, i+1, err)
+		}
+		if len(row) > 2 {
+			if sp.Removed, err = parseDate(row[2]); err != nil {
+				return false, fmt.Errorf("%s:%d: %v", file, i+1, err)
+			}
+		}
+		ticker := strings.TrimSpace(row[0])
+		spans[ticker] = append(spans[ticker], sp)
+	}
+	histories[name] = spans
+	return true, nil
+}
+
+// IsMember reports whether ticker was in the index on date.
+func (m *Membership) IsMember(ticker string, date time.Time) bool {
+	membershipMu.RLock()
+	defer membershipMu.RUnlock()
+	return contains(m.Name, ticker, date)
+}
+
+// Members lists the members of the index on date.
+func (m *Membership) Members(date time.Time) []string {
+	membershipMu.RLock()
+	defer membershipMu.RUnlock()
+	candidates := make(map[string]bool)
+	collectCandidates(m.Name, candidates, make(map[string]bool))
+	members := []string{}
+	for ticker := range candidates {
+		if contains(m.Name, ticker, date) {
+			members = append(members, ticker)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// PointInTime is false when any part of the membership comes from a static
+// snapshot rather than a constituents history.
+func (m *Membership) PointInTime() bool {
+	membershipMu.RLock()
+	defer membershipMu.RUnlock()
+	return pointInTime(m.Name)
+}
+
+// KnownAt is when the membership used for date became known, zero if it was
+// known all along.
+func (m *Membership) KnownAt(date time.Time) time.Time {
+	membershipMu.RLock()
+	defer membershipMu.RUnlock()
+	return publishedAt(m.Name, date)
+}
+
+func spansContain(spans []span, date time.Time) bool {
+	for _, sp := range spans {
+		if !sp.Added.IsZero() && date.Before(sp.Added) {
+			continue
+		}
+		if !sp.Removed.IsZero() && !date.Before(sp.Removed) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Delisted returns the delisting of ticker if it happened on or before date.
+// Delistings are read once from constituents/delisted.csv (ticker,date,price).
+func Delisted(ticker string, date time.Time) (Delisting, bool, error) {
+	membershipMu.Lock()
+	defer membershipMu.Unlock()
+	if delistings == nil {
+		file := "constituents/delisted.csv"
+		rows, err := readCSV(file)
+		if err != nil && !os.IsNotExist(err) {
+			return Delisting{}, false, err
+		}
+		delistings = make(map[string]Delisting)
+		for i, row := range rows {
+			if len(row) < 2 {
+				return Delisting{}, false, fmt.Errorf("%s:%d: expected ticker,date,price", file, i+1)
+			}
+			var d Delisting
+			if d.Date, err = parseDate(row[1]); err != nil {
+				return Delisting{}, false, fmt.Errorf("%s:%d: %v", file, i+1, err)
+			}
+			if len(row) > 2 && strings.TrimSpace(row[2]) != "" {
+				if d.Price, err = strconv.ParseFloat(strings.TrimSpace(row[2]), 64); err != nil {
+					return Delisting{}, false, fmt.Errorf("%s:%d: %v", file, i+1, err)
+				}
+			}
+			delistings[strings.TrimSpace(row[0])] = d
+		}
+	}
+	d, ok := delistings[ticker]
+	if !ok || date.Before(d.Date) {
+		return Delisting{}, false, nil
+	}
+	return d, true, nil
+}
+
+// readCSV reads all rows of a csv file, skipping a header row and # comments.
+func readCSV(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	var rows [][]string
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 && strings.EqualFold(strings.TrimSpace(row[0]), "ticker") {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(dateLayout, s, exchangeTZ)
+}
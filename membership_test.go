@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func day(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := parseDate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// inTempDir runs the rest of the test in an empty directory, as the caches
+// and data files are all found relative to the working directory.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func writeTestFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpansContain(t *testing.T) {
+	spans := []span{
+		{Added: day(t, "2010-01-04"), Removed: day(t, "2012-06-01")},
+		{Added: day(t, "2015-03-02")},
+	}
+	for _, c := range []struct {
+		date string
+		want bool
+	}{
+		{"2009-12-31", false},
+		{"2010-01-04", true}, // added that day
+		{"2012-05-31", true},
+		{"2012-06-01", false}, // removed that day
+		{"2014-01-02", false},
+		{"2015-03-02", true},
+		{"2030-01-02", true},
+	} {
+		if got := spansContain(spans, day(t, c.date)); got != c.want {
+			t.Errorf("spansContain(%s) = %v, want %v", c.date, got, c.want)
+		}
+	}
+	if !spansContain([]span{{}}, day(t, "1990-01-02")) {
+		t.Errorf("a span with no dates should always contain")
+	}
+	if spansContain(nil, day(t, "2010-01-04")) {
+		t.Errorf("no spans should never contain")
+	}
+}
+
+func TestMembershipHistory(t *testing.T) {
+	inTempDir(t)
+	writeTestFile(t, "constituents/spanidx.csv", `ticker,added,removed
+AAA,,2012-06-01
+BBB,2011-01-03,
+CCC,2010-01-04,2011-01-03
+CCC,2013-01-02,
+`)
+	m, err := loadMembership("spanidx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.PointInTime() {
+		t.Errorf("a constituents history should be point in time")
+	}
+	for _, c := range []struct {
+		date string
+		want []string
+	}{
+		{"2009-06-01", []string{"AAA"}},
+		{"2010-06-01", []string{"AAA", "CCC"}},
+		{"2011-01-03", []string{"AAA", "BBB"}},
+		{"2012-06-01", []string{"BBB"}},
+		{"2013-01-02", []string{"BBB", "CCC"}},
+	} {
+		if got := m.Members(day(t, c.date)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Members(%s) = %v, want %v", c.date, got, c.want)
+		}
+	}
+	if m.IsMember("DDD", day(t, "2013-01-02")) {
+		t.Errorf("DDD was never a member")
+	}
+}
+
+func TestDelisted(t *testing.T) {
+	inTempDir(t)
+	delistings = nil
+	t.Cleanup(func() { delistings = nil })
+	writeTestFile(t, "constituents/delisted.csv", `ticker,date,price
+AAA,2012-06-01,3.25
+BBB,2014-02-03,
+`)
+	for _, c := range []struct {
+		ticker string
+		date   string
+		ok     bool
+		price  float64
+	}{
+		{"AAA", "2012-05-31", false, 0},
+		{"AAA", "2012-06-01", true, 3.25},
+		{"AAA", "2013-01-02", true, 3.25},
+		{"BBB", "2014-02-03", true, 0}, // price unknown
+		{"CCC", "2014-02-03", false, 0},
+	} {
+		d, ok, err := Delisted(c.ticker, day(t, c.date))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.ok || d.Price != c.price {
+			t.Errorf("Delisted(%s, %s) = %+v, %v, want %v at %g", c.ticker, c.date, d, ok, c.ok, c.price)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ticker metadata is read from metadata/tickers.csv:
+//
+//	ticker,sector,industry,cap,exchange
+//	AAPL,Technology,Consumer Electronics,mega,NASDAQ
+//
+// Tickers missing from the file are reported in the "Unknown" sector.
+
+const unknownSector = "Unknown"
+
+type TickerInfo struct {
+	Ticker    string
+	Sector    string
+	Industry  string
+	MarketCap string
+	Exchange  string
+}
+
+var (
+	metadataOnce sync.Once
+	metadata     map[string]TickerInfo
+	metadataErr  error
+	metadataAsOf time.Time // when the file was written, as sectors change
+)
+
+func loadMetadata() (map[string]TickerInfo, error) {
+	metadataOnce.Do(func() {
+		metadata = make(map[string]TickerInfo)
+		file := "metadata/tickers.csv"
+		rows, err := readCSV(file)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			metadataErr = err
+			return
+		}
+		if fi, err := os.Stat(file); err == nil {
+			metadataAsOf = fi.ModTime()
+		}
+		for i, row := range rows {
+			if len(row) < 2 {
+				metadataErr = fmt.Errorf("%s:%d: expected ticker,sector,industry,cap,exchange", file, i+1)
+				return
+			}
+			for len(row) < 5 {
+				row = append(row, "")
+			}
+			info := TickerInfo{
+				Ticker:    strings.TrimSpace(row[0]),
+				Sector:    strings.TrimSpace(row[1]),
+				Industry:  strings.TrimSpace(row[2]),
+				MarketCap: strings.TrimSpace(row[3]),
+				Exchange:  strings.TrimSpace(row[4]),
+			}
+			metadata[info.Ticker] = info
+		}
+	})
+	return metadata, metadataErr
+}
+
+// tickerInfo looks up a ticker, filling in the unknown sector if needed.
+// loadMetadata must have succeeded before.
+func tickerInfo(ticker string) TickerInfo {
+	info, ok := metadata[ticker]
+	if !ok {
+		info.Ticker = ticker
+	}
+	if info.Sector == "" {
+		info.Sector = unknownSector
+	}
+	return info
+}
+
+// sectorAllowed applies the strategy's sector include and exclude lists.
+func sectorAllowed(s Strategy, ticker string) bool {
+	sector := tickerInfo(ticker).Sector
+	for _, excluded := range s.ExcludeSectors {
+		if strings.EqualFold(sector, excluded) {
+			return false
+		}
+	}
+	if len(s.IncludeSectors) == 0 {
+		return true
+	}
+	for _, included := range s.IncludeSectors {
+		if strings.EqualFold(sector, included) {
+			return true
+		}
+	}
+	return false
+}
+
+// sectorRoom returns how much more can be put into ticker's sector before it
+// exceeds the strategy's MaxSectorPct of equity, valuing holdings at the last
+// price seen for them and counting the resting buys at the price they were
+// sized at.
+func sectorRoom(s Strategy, ticker string, acct *Account) float64 {
+	if s.MaxSectorPct == 0 {
+		return math.MaxFloat64
+	}
+	sector := tickerInfo(ticker).Sector
+	equity, exposure := acct.Cash, 0.0
+	for held, amount := range acct.Portfolio {
+		value := float64(amount) * acct.LastPrice[held]
+		equity += value
+		if tickerInfo(held).Sector == sector {
+			exposure += value
+		}
+	}
+	for _, o := range acct.Orders {
+		if o.Side == "buy" && tickerInfo(o.Ticker).Sector == sector {
+			exposure += float64(o.Shares) * o.Price
+		}
+	}
+	// a sector already over the limit has no room, not negative room
+	return math.Max(0, s.MaxSectorPct*equity-exposure)
+}
+
+// sectorPnL attributes profit and loss to sectors from the ledger and the
+// value of the positions still held.
+func sectorPnL(ledger []Trade, values map[string]float64) map[string]float64 {
+	pnl := make(map[string]float64)
+	for _, t := range ledger {
+		pnl[tickerInfo(t.Ticker).Sector] += t.Cash()
+	}
+	for ticker, value := range values {
+		pnl[tickerInfo(ticker).Sector] += value
+	}
+	return pnl
+}
+
+func formatSectorPnL(pnl map[string]float64) string {
+	sectors := []string{}
+	for sector := range pnl {
+		sectors = append(sectors, sector)
+	}
+	sort.Slice(sectors, func(i, j int) bool { return pnl[sectors[i]] > pnl[sectors[j]] })
+	var b strings.Builder
+	for _, sector := range sectors {
+		fmt.Fprintf(&b, "    %-24s %+14.2f\n", sector, pnl[sector])
+	}
+	return b.String()
+}
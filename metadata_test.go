@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// withMetadata stands in info for the contents of metadata/tickers.csv.
+func withMetadata(t *testing.T, info ...TickerInfo) {
+	t.Helper()
+	loadMetadata()
+	saved := metadata
+	metadata = make(map[string]TickerInfo)
+	for _, i := range info {
+		metadata[i.Ticker] = i
+	}
+	t.Cleanup(func() { metadata = saved })
+}
+
+func TestSectorAllowed(t *testing.T) {
+	withMetadata(t,
+		TickerInfo{Ticker: "BANK", Sector: "Financial Services"},
+		TickerInfo{Ticker: "CHIP", Sector: "Technology"},
+	)
+	for _, c := range []struct {
+		include, exclude []string
+		ticker           string
+		want             bool
+	}{
+		{nil, nil, "BANK", true},
+		{nil, nil, "NONE", true},
+		{[]string{"technology"}, nil, "CHIP", true}, // case doesn't matter
+		{[]string{"Technology"}, nil, "BANK", false},
+		{[]string{"Technology"}, nil, "NONE", false},
+		{[]string{"Unknown"}, nil, "NONE", true},
+		{nil, []string{"Financial Services"}, "BANK", false},
+		{nil, []string{"Financial Services"}, "CHIP", true},
+		{[]string{"Technology"}, []string{"Technology"}, "CHIP", false}, // exclude wins
+	} {
+		s := Strategy{IncludeSectors: c.include, ExcludeSectors: c.exclude}
+		if got := sectorAllowed(s, c.ticker); got != c.want {
+			t.Errorf("sectorAllowed(include %v, exclude %v, %s) = %v, want %v", c.include, c.exclude, c.ticker, got, c.want)
+		}
+	}
+}
+
+func TestSectorRoom(t *testing.T) {
+	withMetadata(t,
+		TickerInfo{Ticker: "BANK", Sector: "Financial Services"},
+		TickerInfo{Ticker: "LOAN", Sector: "Financial Services"},
+		TickerInfo{Ticker: "CHIP", Sector: "Technology"},
+	)
+	for _, c := range []struct {
+		name      string
+		max       float64
+		portfolio map[string]int
+		orders    []Order
+		ticker    string
+		want      float64
+	}{
+		{"no limit", 0, map[string]int{"BANK": 100}, nil, "LOAN", math.MaxFloat64},
+		// equity is 5000 cash and 5000 in BANK
+		{"same sector", 0.6, map[string]int{"BANK": 100}, nil, "LOAN", 1000},
+		{"other sector", 0.6, map[string]int{"BANK": 100}, nil, "CHIP", 6000},
+		{"over the limit", 0.4, map[string]int{"BANK": 100}, nil, "LOAN", 0},
+		{"pending buy", 0.6, map[string]int{"BANK": 100}, []Order{{Ticker: "LOAN", Side: "buy", Shares: 20, Price: 25}}, "BANK", 500},
+		{"pending sell", 0.6, map[string]int{"BANK": 100}, []Order{{Ticker: "BANK", Side: "sell", Shares: 100, Price: 50}}, "LOAN", 1000},
+	} {
+		acct := newAccount(5000)
+		acct.Portfolio = c.portfolio
+		acct.LastPrice["BANK"] = 50
+		acct.Orders = c.orders
+		s := Strategy{MaxSectorPct: c.max}
+		if got := sectorRoom(s, c.ticker, acct); got != c.want {
+			t.Errorf("%s: sectorRoom = %g, want %g", c.name, got, c.want)
+		}
+	}
+}
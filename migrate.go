@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Older caches keyed quotes by time.Time values made in the zone of whatever
+// machine ran the backtest, stepping 24 hours at a time so keys drifted an
+// hour around DST changes. Those keys were also what the bar was fetched
+// from, so the bar behind a key is the first session opening at or after it.
+
+type legacyQuotes struct {
+	Ticker      string
+	ClosePrices map[time.Time]float64
+	Changes     map[time.Time]float64
+}
+
+// loadQuotes reads a quote cache, converting it in memory if it is in the
+// old format. A missing file gives empty quotes. Only migrate rewrites old
+// files, and a fetch saves the file in the new format.
+func loadQuotes(file string) (*Quotes, error) {
+	result, _, err := readQuotes(file)
+	return result, err
+}
+
+// readQuotes is loadQuotes, also reporting whether the file is in the old
+// format.
+func readQuotes(file string) (*Quotes, bool, error) {
+	result := &Quotes{
+		ClosePrices: make(map[string]float64),
+		Changes:     make(map[string]float64),
+		Missing:     make(map[string]bool),
+		Opens:       make(map[string]float64),
+		Highs:       make(map[string]float64),
+		Lows:        make(map[string]float64),
+	}
+	if _, err := os.Stat(file); err != nil {
+		return result, false, nil
+	}
+	if err := Load(file, result); err == nil {
+		return result, false, nil
+	}
+	legacy := new(legacyQuotes)
+	if err := Load(file, legacy); err != nil {
+		return nil, false, err
+	}
+	result.Ticker = legacy.Ticker
+	for t, closePrice := range legacy.ClosePrices {
+		key := legacySession(t)
+		result.ClosePrices[key] = closePrice
+		if change, ok := legacy.Changes[t]; ok {
+			result.Changes[key] = change
+		}
+	}
+	return result, true, nil
+}
+
+// legacySession maps an old cache key to the trading date it was fetched for.
+func legacySession(t time.Time) string {
+	day := midnight(t)
+	if t.After(day.Add(9*time.Hour + 30*time.Minute)) {
+		day = day.AddDate(0, 0, 1)
+	}
+	return dateKey(day)
+}
+
+func migrate(c *cli.Context) error {
+	files, err := ioutil.ReadDir("quotes")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	converted := 0
+	for _, f := range files {
+		file := filepath.Join("quotes", f.Name())
+		result, legacy, err := readQuotes(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		if !legacy {
+			continue
+		}
+		if err := Save(file, result); err != nil {
+			return err
+		}
+		converted++
+	}
+	fmt.Printf("quotes: %d files, %d converted\n", len(files), converted)
+
+	files, err = ioutil.ReadDir("earningdate")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	rekeyed, refetched := 0, 0
+	for _, f := range files {
+		file := filepath.Join("earningdate", f.Name())
+		date, err := time.ParseInLocation(dateLayout, f.Name(), exchangeTZ)
+		if err != nil {
+			continue
+		}
+		result := new(EarningDate)
+		if err := Load(file, result); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if result.Version < earningsVersion {
+			// only the russell2k companies were kept, the rest has to be fetched
+			if _, err := downloadEarnings(ctx, date); err != nil {
+				return err
+			}
+			refetched++
+			continue
+		}
+		if result.Date.Equal(date) {
+			continue
+		}
+		result.Date = date
+		if err := Save(file, result); err != nil {
+			return err
+		}
+		rekeyed++
+	}
+	fmt.Printf("earnings: %d files, %d rekeyed, %d fetched again\n", len(files), rekeyed, refetched)
+	return nil
+}
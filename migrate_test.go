@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLegacySession(t *testing.T) {
+	for _, c := range []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2018, 7, 2, 8, 0, 0, 0, exchangeTZ), "2018-07-02"},
+		{time.Date(2018, 7, 2, 9, 30, 0, 0, exchangeTZ), "2018-07-02"},
+		{time.Date(2018, 7, 2, 9, 31, 0, 0, exchangeTZ), "2018-07-03"},
+		{time.Date(2018, 7, 2, 20, 0, 0, 0, exchangeTZ), "2018-07-03"},
+		{time.Date(2018, 7, 2, 12, 0, 0, 0, time.UTC), "2018-07-02"}, // 8am in New York
+		{time.Date(2018, 7, 3, 2, 0, 0, 0, time.UTC), "2018-07-03"},  // 10pm the day before
+		// a day stepped 24 hours from before DST started is an hour late
+		{time.Date(2018, 3, 12, 1, 0, 0, 0, exchangeTZ), "2018-03-12"},
+	} {
+		if got := legacySession(c.t); got != c.want {
+			t.Errorf("legacySession(%v) = %s, want %s", c.t, got, c.want)
+		}
+	}
+}
+
+func TestReadLegacyQuotes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "AAA")
+	at := time.Date(2018, 7, 2, 20, 0, 0, 0, exchangeTZ)
+	old := &legacyQuotes{
+		Ticker:      "AAA",
+		ClosePrices: map[time.Time]float64{at: 10},
+		Changes:     map[time.Time]float64{at: 0.05},
+	}
+	if err := Save(file, old); err != nil {
+		t.Fatal(err)
+	}
+	q, legacy, err := readQuotes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !legacy || q.Ticker != "AAA" || q.ClosePrices["2018-07-03"] != 10 || q.Changes["2018-07-03"] != 0.05 {
+		t.Errorf("readQuotes = %+v, %v", q, legacy)
+	}
+	if _, legacy, _ := readQuotes(file); !legacy {
+		t.Errorf("readQuotes rewrote the file")
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// localBroker fills market orders straight away at the close of the session
+// they are for, from the quote cache, trading an Account. The other order
+// types rest in the Account until Advance fills them from later bars, as the
+// backtest does. Paper accounts trade through one, and mockbroker serves one
+// over the Alpaca API so the adapter and the live path can be tried without
+// a real broker. Its resting orders fill when a client posts to
+// /mock/advance, which Alpaca doesn't have, to move it to a later session.
+
+type localBroker struct {
+	mu     sync.Mutex
+	prefix string
+	asOf   time.Time // prices orders without a date, if set
+	acct   *Account
+	orders *[]Order
+	fills  *[]Fill
+}
+
+func newLocalBroker(prefix string, acct *Account, orders *[]Order, fills *[]Fill) *localBroker {
+	return &localBroker{prefix: prefix, acct: acct, orders: orders, fills: fills}
+}
+
+func (b *localBroker) Account(ctx context.Context) (BrokerAccount, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BrokerAccount{Cash: b.acct.Cash, Equity: calculateTotal(b.acct.Cash, b.acct.markToMarket())}, nil
+}
+
+func (b *localBroker) Positions(ctx context.Context) ([]Position, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cost := make(map[string]float64)
+	for _, f := range *b.fills {
+		if f.Action == "BUY" {
+			cost[f.Ticker] -= f.Cash()
+		} else {
+			delete(cost, f.Ticker)
+		}
+	}
+	positions := []Position{}
+	for ticker, shares := range b.acct.Portfolio {
+		positions = append(positions, Position{Ticker: ticker, Shares: shares, AvgPrice: cost[ticker] / float64(shares)})
+	}
+	return positions, nil
+}
+
+func (b *localBroker) find(clientID string) (Order, bool) {
+	for _, o := range *b.orders {
+		if o.ClientOrderID == clientID {
+			return o, true
+		}
+	}
+	return Order{}, false
+}
+
+// PlaceOrder fills a market order o at the close of o.Date, or else at the
+// close of asOf or the latest close. Orders the account can't cover are
+// rejected.
+func (b *localBroker) PlaceOrder(ctx context.Context, o Order) (Order, error) {
+	o, _, err := b.place(ctx, o)
+	return o, err
+}
+
+// place is PlaceOrder, also telling whether the order was already placed
+// under its client order ID.
+func (b *localBroker) place(ctx context.Context, o Order) (Order, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if o.ClientOrderID != "" {
+		if existing, ok := b.find(o.ClientOrderID); ok {
+			return existing, true, nil
+		}
+	}
+	if o.Side != "buy" && o.Side != "sell" {
+		return Order{}, false, fmt.Errorf("unknown side %q", o.Side)
+	}
+	if o.Shares <= 0 {
+		return Order{}, false, fmt.Errorf("order for %d shares", o.Shares)
+	}
+	o.ID = fmt.Sprintf("%s-%d", b.prefix, len(*b.orders)+1)
+	o.Submitted = time.Now()
+	o.Status = orderRejected
+
+	date := o.Date
+	if date.IsZero() {
+		date = b.asOf
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+	if o.Type != "market" {
+		o.Date, o.Status = midnight(date), orderNew
+		if o.Expires.IsZero() {
+			o.Expires = SessionOffset(o.Date, marketOrderSessions)
+		}
+		b.acct.Orders = append(b.acct.Orders, o)
+		*b.orders = append(*b.orders, o)
+		return o, false, nil
+	}
+	q, ok, err := lastClose(ctx, o.Ticker, date)
+	if err != nil {
+		return Order{}, false, err
+	}
+	t := Trade{Date: midnight(date), Ticker: o.Ticker, Action: strings.ToUpper(o.Side), Shares: o.Shares, Price: q.Close}
+	switch {
+	case !ok:
+	case o.Side == "buy" && -t.Cash() > b.acct.Cash:
+	case o.Side == "sell" && o.Shares > b.acct.Portfolio[o.Ticker]:
+	default:
+		b.acct.apply(t)
+		b.acct.LastPrice[t.Ticker] = t.Price
+		*b.fills = append(*b.fills, Fill{t, o.Submitted, o.ID})
+		o.Status, o.FilledShares, o.FilledPrice = orderFilled, t.Shares, t.Price
+	}
+	*b.orders = append(*b.orders, o)
+	return o, false, nil
+}
+
+// advance fills the resting orders that the bars of session date reach and
+// returns the orders it is done with.
+func (b *localBroker) advance(ctx context.Context, date time.Time) ([]Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	done, err := fillOrders(ctx, b.acct, date)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, o := range done {
+		for i := range *b.orders {
+			if (*b.orders)[i].ID == o.ID {
+				(*b.orders)[i] = o
+			}
+		}
+		if o.Status == orderFilled {
+			t := Trade{Date: midnight(date), Ticker: o.Ticker, Action: strings.ToUpper(o.Side), Shares: o.FilledShares, Price: o.FilledPrice}
+			*b.fills = append(*b.fills, Fill{t, now, o.ID})
+		}
+	}
+	return done, nil
+}
+
+// Advance moves b over the closed sessions after the last one it advanced
+// over up to date, moving asOf along if it is set, and returns the orders it
+// is done with.
+func (b *localBroker) Advance(ctx context.Context, date time.Time) ([]Order, error) {
+	b.mu.Lock()
+	from := SessionOffset(b.acct.Through, 1)
+	b.mu.Unlock()
+	done := []Order{}
+	for _, d := range Sessions(from, date.AddDate(0, 0, 1)) {
+		if !sessionClosed(d) {
+			break
+		}
+		orders, err := b.advance(ctx, d)
+		if err != nil {
+			return done, fmt.Errorf("%s: %v", dateKey(d), err)
+		}
+		done = append(done, orders...)
+		b.mu.Lock()
+		b.acct.Through = d
+		if !b.asOf.IsZero() {
+			b.asOf = d
+		}
+		b.mu.Unlock()
+	}
+	return done, nil
+}
+
+func (b *localBroker) CancelOrder(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, o := range *b.orders {
+		if o.ID != id {
+			continue
+		}
+		if o.Status != orderNew {
+			return fmt.Errorf("order %s is %s", id, o.Status)
+		}
+		(*b.orders)[i].Status = orderCanceled
+		resting := []Order{}
+		for _, r := range b.acct.Orders {
+			if r.ID != id {
+				resting = append(resting, r)
+			}
+		}
+		b.acct.Orders = resting
+		return nil
+	}
+	return fmt.Errorf("no order %s", id)
+}
+
+func (b *localBroker) OrderStatus(ctx context.Context, id string) (Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, o := range *b.orders {
+		if o.ID == id {
+			return o, nil
+		}
+	}
+	return Order{}, fmt.Errorf("no order %s", id)
+}
+
+func (b *localBroker) Fills(ctx context.Context, since time.Time) ([]BrokerFill, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fills := []BrokerFill{}
+	for _, f := range *b.fills {
+		if !f.Recorded.After(since) || f.OrderID == "" {
+			continue
+		}
+		fills = append(fills, BrokerFill{
+			OrderID: f.OrderID,
+			Ticker:  f.Ticker,
+			Side:    strings.ToLower(f.Action),
+			Shares:  f.Shares,
+			Price:   f.Price,
+			Time:    f.Recorded,
+		})
+	}
+	return fills, nil
+}
+
+var mockbrokerFlags = []cli.Flag{
+	cli.StringFlag{Name: "addr", Value: "127.0.0.1:8089", Usage: "address to listen on"},
+	cli.Float64Flag{Name: "cash", Value: 100000, Usage: "starting cash"},
+	cli.StringFlag{Name: "date", Usage: "fill at the closes of this session rather than the latest, until /mock/advance moves on"},
+}
+
+// mockbroker serves an in-memory account over the Alpaca API.
+func mockbroker(c *cli.Context) error {
+	acct := newAccount(c.Float64("cash"))
+	orders, fills := []Order{}, []Fill{}
+	b := newLocalBroker("mock", acct, &orders, &fills)
+	acct.Through = PreviousSession(time.Now())
+	if c.String("date") != "" {
+		var err error
+		if b.asOf, err = parseDate(c.String("date")); err != nil {
+			return err
+		}
+		acct.Through = midnight(b.asOf)
+	}
+	fmt.Printf("mock broker with %.2f listening on http://%s\n", acct.Cash, c.String("addr"))
+	return http.ListenAndServe(c.String("addr"), b)
+}
+
+func (b *localBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := r.URL.Path
+	switch {
+	case path == "/v2/account" && r.Method == "GET":
+		acct, _ := b.Account(ctx)
+		writeJSON(w, http.StatusOK, alpacaAccount{Cash: formatNumber(acct.Cash), Equity: formatNumber(acct.Equity)})
+	case path == "/v2/positions" && r.Method == "GET":
+		positions, _ := b.Positions(ctx)
+		list := []alpacaPosition{}
+		for _, p := range positions {
+			list = append(list, alpacaPosition{Symbol: p.Ticker, Qty: strconv.Itoa(p.Shares), AvgEntryPrice: formatNumber(p.AvgPrice)})
+		}
+		writeJSON(w, http.StatusOK, list)
+	case path == "/v2/orders" && r.Method == "POST":
+		var ao alpacaOrder
+		if err := json.NewDecoder(r.Body).Decode(&ao); err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		o, existed, err := b.place(ctx, ao.order())
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if existed {
+			writeAPIError(w, http.StatusUnprocessableEntity, "client_order_id must be unique")
+			return
+		}
+		writeJSON(w, http.StatusOK, toAlpacaOrder(o))
+	case path == "/v2/orders" && r.Method == "GET":
+		b.mu.Lock()
+		list := []alpacaOrder{}
+		for _, o := range *b.orders {
+			list = append(list, toAlpacaOrder(o))
+		}
+		b.mu.Unlock()
+		writeJSON(w, http.StatusOK, list)
+	case path == "/v2/orders:by_client_order_id" && r.Method == "GET":
+		b.mu.Lock()
+		o, ok := b.find(r.URL.Query().Get("client_order_id"))
+		b.mu.Unlock()
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "order not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, toAlpacaOrder(o))
+	case strings.HasPrefix(path, "/v2/orders/") && r.Method == "GET":
+		o, err := b.OrderStatus(ctx, strings.TrimPrefix(path, "/v2/orders/"))
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, toAlpacaOrder(o))
+	case strings.HasPrefix(path, "/v2/orders/") && r.Method == "DELETE":
+		if err := b.CancelOrder(ctx, strings.TrimPrefix(path, "/v2/orders/")); err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/mock/advance" && r.Method == "POST":
+		// to the session given, else the one after asOf, else the latest
+		b.mu.Lock()
+		date := b.asOf
+		b.mu.Unlock()
+		if date.IsZero() {
+			date = time.Now()
+		} else {
+			date = SessionOffset(date, 1)
+		}
+		if d := r.URL.Query().Get("date"); d != "" {
+			var err error
+			if date, err = parseDate(d); err != nil {
+				writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+		}
+		done, err := b.Advance(ctx, date)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		list := []alpacaOrder{}
+		for _, o := range done {
+			list = append(list, toAlpacaOrder(o))
+		}
+		writeJSON(w, http.StatusOK, list)
+	case path == "/v2/account/activities/FILL" && r.Method == "GET":
+		var since time.Time
+		if after := r.URL.Query().Get("after"); after != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, after); err != nil {
+				writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+		}
+		fills, _ := b.Fills(ctx, since)
+		list := []alpacaActivity{}
+		for i, f := range fills {
+			list = append(list, alpacaActivity{
+				ID:              strconv.Itoa(i + 1),
+				ActivityType:    "FILL",
+				TransactionTime: f.Time,
+				Symbol:          f.Ticker,
+				Side:            f.Side,
+				Qty:             strconv.Itoa(f.Shares),
+				Price:           formatNumber(f.Price),
+				OrderID:         f.OrderID,
+			})
+		}
+		writeJSON(w, http.StatusOK, list)
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, alpacaError{Code: status * 100000, Message: message})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Monte Carlo robustness analysis. By default the round trips in the
+// strategy's ledger are bootstrapped: each path draws as many trips as the
+// backtest made, with replacement, and compounds their return on equity.
+// With --jitter or --drop every path is instead a full backtest where entries
+// move by up to a trading day, either way for buys at the close and only later
+// for orders that can't fill before their signal, and a fraction of signals
+// is ignored.
+
+var montecarloFlags = []cli.Flag{
+	cli.StringFlag{Name: "strategy", Usage: "strategy to analyze (default the first)"},
+	cli.IntFlag{Name: "paths", Value: 1000, Usage: "number of simulated paths"},
+	cli.BoolFlag{Name: "jitter", Usage: "move each entry randomly by -1, 0 or +1 trading day, or by 0 or +1 if it isn't bought at the close"},
+	cli.Float64Flag{Name: "drop", Usage: "fraction of signals to drop at random"},
+	cli.Float64Flag{Name: "ruin", Value: 0.5, Usage: "equity, as a fraction of the start, that counts as ruin"},
+	cli.Int64Flag{Name: "seed", Usage: "random seed (default the time)"},
+}
+
+// perturbation randomizes the signals of a backtest.
+type perturbation struct {
+	mu     sync.Mutex
+	rand   *rand.Rand
+	Jitter bool
+	Drop   float64
+}
+
+// entryShift returns how many days to move a buy and whether to drop it. The
+// buy only moves earlier if early is set.
+func (p *perturbation) entryShift(early bool) (int, bool) {
+	if p == nil {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Drop > 0 && p.rand.Float64() < p.Drop {
+		return 0, true
+	}
+	if p.Jitter && early {
+		return p.rand.Intn(3) - 1, false
+	}
+	if p.Jitter {
+		return p.rand.Intn(2), false
+	}
+	return 0, false
+}
+
+type path struct {
+	Total       float64
+	MaxDrawdown float64
+	Ruined      bool
+}
+
+func montecarlo(c *cli.Context) error {
+	s, err := findStrategy(c.String("strategy"))
+	if err != nil {
+		return err
+	}
+	seed := c.Int64("seed")
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	n := c.Int("paths")
+	if n <= 0 {
+		return fmt.Errorf("need at least one path")
+	}
+	ruin := c.Float64("ruin") * s.StartCash
+	ctx, stop := interruptContext()
+	defer stop()
+	now := time.Now()
+	start := yearsAgo(s.NumYears)
+
+	paths := make([]path, n)
+	if c.Bool("jitter") || c.Float64("drop") > 0 {
+		fmt.Printf("running %d perturbed backtests of %s:\n", n, s.Name)
+		runners := make([]*runner, n)
+		for i := range runners {
+			p := &perturbation{rand: rand.New(rand.NewSource(seed + int64(i))), Jitter: c.Bool("jitter"), Drop: c.Float64("drop")}
+			runners[i] = newRunner(ctx, s, newAccount(s.StartCash), start, p)
+		}
+		if err := pass(ctx, runners, start, now); err != nil {
+			return err
+		}
+		for i, r := range runners {
+			err := r.Err
+			var total float64
+			if err == nil {
+				total, err = equity(ctx, r.Account, PreviousSession(now))
+			}
+			if err != nil {
+				return fmt.Errorf("path %d: %v", i, err)
+			}
+			curve := append(append([]float64{s.StartCash}, r.Account.Equity...), total)
+			paths[i] = path{Total: total, MaxDrawdown: maxDrawdown(curve), Ruined: minimum(curve) < ruin}
+		}
+	} else {
+		fmt.Printf("bootstrapping %d paths of %s:\n", n, s.Name)
+		acct := newAccount(s.StartCash)
+		if err := backtest(ctx, s, acct, start, now, nil); err != nil {
+			return err
+		}
+		values, err := holdingValues(ctx, acct, PreviousSession(now))
+		if err != nil {
+			return err
+		}
+		returns := tripReturns(s.StartCash, acct.Ledger, values)
+		if len(returns) == 0 {
+			return fmt.Errorf("%s made no trades", s.Name)
+		}
+		r := rand.New(rand.NewSource(seed))
+		for i := range paths {
+			curve := []float64{s.StartCash}
+			for range returns {
+				last := curve[len(curve)-1]
+				curve = append(curve, last*(1+returns[r.Intn(len(returns))]))
+			}
+			paths[i] = path{Total: curve[len(curve)-1], MaxDrawdown: maxDrawdown(curve), Ruined: minimum(curve) < ruin}
+		}
+	}
+
+	totals := make([]float64, n)
+	drawdowns := make([]float64, n)
+	ruined := 0
+	for i, p := range paths {
+		totals[i] = p.Total
+		drawdowns[i] = p.MaxDrawdown
+		if p.Ruined {
+			ruined++
+		}
+	}
+	sort.Float64s(totals)
+	sort.Float64s(drawdowns)
+	fmt.Printf("  %-6s %16s %10s %10s\n", "pct", "total", "cagr", "drawdown")
+	for _, pct := range []float64{5, 25, 50, 75, 95} {
+		total := percentile(totals, pct)
+		fmt.Printf("  %-6s %16.2f %9.2f%% %9.2f%%\n", fmt.Sprintf("p%.0f", pct), total,
+			cagr(s.StartCash, total, float64(s.NumYears))*100, percentile(drawdowns, pct)*100)
+	}
+	fmt.Printf("  probability of ruin (below %.0f): %.2f%%\n", ruin, float64(ruined)/float64(n)*100)
+	return nil
+}
+
+// tripReturns turns a ledger into the return on equity of every round trip,
+// counting positions still open at their final value.
+func tripReturns(cash float64, ledger []Trade, values map[string]float64) []float64 {
+	basis := make(map[string]float64)
+	invested := 0.0
+	returns := []float64{}
+	for _, t := range ledger {
+		if t.Action == "BUY" {
+			basis[t.Ticker] -= t.Cash()
+			invested -= t.Cash()
+			cash += t.Cash()
+			continue
+		}
+		before := cash + invested
+		returns = append(returns, (t.Cash()-basis[t.Ticker])/before)
+		cash += t.Cash()
+		invested -= basis[t.Ticker]
+		delete(basis, t.Ticker)
+	}
+	for ticker, value := range values {
+		returns = append(returns, (value-basis[ticker])/(cash+invested))
+	}
+	return returns
+}
+
+// maxDrawdown is the largest peak to trough fall of curve, as a fraction.
+func maxDrawdown(curve []float64) float64 {
+	peak, worst := 0.0, 0.0
+	for _, v := range curve {
+		peak = math.Max(peak, v)
+		if peak > 0 {
+			worst = math.Max(worst, 1-v/peak)
+		}
+	}
+	return worst
+}
+
+func minimum(values []float64) float64 {
+	low := math.Inf(1)
+	for _, v := range values {
+		low = math.Min(low, v)
+	}
+	return low
+}
+
+// percentile of sorted values, interpolating between neighbours.
+func percentile(sorted []float64, pct float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := pct / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
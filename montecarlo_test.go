@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9 || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+func TestPercentile(t *testing.T) {
+	for _, c := range []struct {
+		sorted []float64
+		pct    float64
+		want   float64
+	}{
+		{nil, 50, 0},
+		{[]float64{7}, 95, 7},
+		{[]float64{1, 2, 3, 4, 5}, 0, 1},
+		{[]float64{1, 2, 3, 4, 5}, 25, 2},
+		{[]float64{1, 2, 3, 4, 5}, 50, 3},
+		{[]float64{1, 2, 3, 4, 5}, 95, 4.8},
+		{[]float64{1, 2, 3, 4, 5}, 100, 5},
+		{[]float64{10, 20}, 50, 15},
+	} {
+		if got := percentile(c.sorted, c.pct); !near(got, c.want) {
+			t.Errorf("percentile(%v, %g) = %g, want %g", c.sorted, c.pct, got, c.want)
+		}
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	for _, c := range []struct {
+		curve []float64
+		want  float64
+	}{
+		{nil, 0},
+		{[]float64{100, 110, 120}, 0},
+		{[]float64{100, 50, 200, 150}, 0.5},
+		{[]float64{100, 80, 90, 60, 120}, 0.4},
+	} {
+		if got := maxDrawdown(c.curve); !near(got, c.want) {
+			t.Errorf("maxDrawdown(%v) = %g, want %g", c.curve, got, c.want)
+		}
+	}
+}
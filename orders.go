@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Signals come from a session's close, which is over by the time they are
+// known, so by default a strategy trades them with orders that fill on later
+// bars: at the next open, at the next close, or at a limit LimitPct through
+// the signal's close. Until they fill the orders rest in the Account, and
+// ones that don't fill in time are dropped and counted as Unfilled. The old
+// rule, trading at the very close that gave the signal, is still there as
+// "close" to compare against.
+
+const (
+	orderOpen  = "open"  // market on the next session's open
+	orderMOC   = "moc"   // market on the next session's close
+	orderLimit = "limit" // limit for LimitDays sessions
+	orderClose = "close" // at the signal's own close
+)
+
+// marketOrderSessions is how long a market order waits for a bar, as when
+// trading in a stock is halted.
+const marketOrderSessions = 3
+
+func (s Strategy) entryOrder() string {
+	if s.EntryOrder == "" {
+		return orderOpen
+	}
+	return s.EntryOrder
+}
+
+func (s Strategy) exitOrder() string {
+	if s.ExitOrder == "" {
+		return orderOpen
+	}
+	return s.ExitOrder
+}
+
+func (s Strategy) checkOrders() error {
+	for _, typ := range []string{s.entryOrder(), s.exitOrder()} {
+		switch typ {
+		case orderOpen, orderMOC, orderLimit, orderClose:
+		default:
+			return fmt.Errorf("unknown order type %q", typ)
+		}
+	}
+	if _, ok := intervals[s.EntryInterval]; s.EntryInterval != "" && !ok {
+		return fmt.Errorf("unknown intraday interval %q", s.EntryInterval)
+	}
+	return nil
+}
+
+// order is the order of s to buy or sell shares of ticker after a signal at
+// price on date. It can fill on the sessions after date.
+func (s Strategy) order(side, ticker string, shares int, price float64, date time.Time) Order {
+	typ, limit := s.entryOrder(), price*(1-s.LimitPct)
+	if side == "sell" {
+		typ, limit = s.exitOrder(), price*(1+s.LimitPct)
+	}
+	o := Order{
+		ClientOrderID: clientOrderID(s, date, ticker, side),
+		Ticker:        ticker,
+		Side:          side,
+		Type:          typ,
+		Shares:        shares,
+		Price:         price,
+		Date:          date,
+		Status:        orderNew,
+		Expires:       SessionOffset(date, marketOrderSessions),
+	}
+	if typ == orderLimit {
+		days := s.LimitDays
+		if days < 1 {
+			days = 1
+		}
+		o.LimitPrice, o.Expires = limit, SessionOffset(date, days)
+	}
+	return o
+}
+
+// committed is the cash the resting buy orders of a would take at the prices
+// they were sized at.
+func (a *Account) committed() float64 {
+	total := 0.0
+	for _, o := range a.Orders {
+		if o.Side == "buy" {
+			total += float64(o.Shares) * o.Price
+		}
+	}
+	return total
+}
+
+func (a *Account) resting(ticker, side string) bool {
+	for _, o := range a.Orders {
+		if o.Ticker == ticker && o.Side == side {
+			return true
+		}
+	}
+	return false
+}
+
+// fillOrders fills the resting orders of acct that the bar of session i
+// reaches, and drops the ones that expire unfilled with it. Buys are cut to
+// the cash there is and sells are for the whole position at the time. It
+// returns the orders it is done with.
+func fillOrders(ctx context.Context, acct *Account, i time.Time) ([]Order, error) {
+	resting, done := []Order{}, []Order{}
+	for _, o := range acct.Orders {
+		if !i.After(o.Date) {
+			resting = append(resting, o)
+			continue
+		}
+		bar := quoteForDate
+		if o.Type == orderLimit {
+			bar = barForDate
+		}
+		q, ok, err := bar(ctx, o.Ticker, i)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			acct.LastPrice[o.Ticker] = q.Close
+			if price, hit := fillPrice(o, q); hit {
+				shares := acct.Portfolio[o.Ticker]
+				if o.Side == "buy" {
+					shares = o.Shares
+					if cost := float64(shares) * price; cost > acct.Cash {
+						shares = int(acct.Cash / price)
+					}
+				}
+				o.Status = orderCanceled
+				if shares > 0 {
+					acct.apply(Trade{Date: i, Ticker: o.Ticker, Action: strings.ToUpper(o.Side), Shares: shares, Price: price})
+					o.Status, o.FilledShares, o.FilledPrice = orderFilled, shares, price
+				} else {
+					acct.Unfilled++
+				}
+				done = append(done, o)
+				continue
+			}
+		}
+		if !i.Before(o.Expires) {
+			o.Status = orderCanceled
+			acct.Unfilled++
+			done = append(done, o)
+			continue
+		}
+		resting = append(resting, o)
+	}
+	acct.Orders = resting
+	return done, nil
+}
+
+// fillPrice is the price o fills at on the bar q, if it fills. A limit order
+// that the open already passes fills at the open.
+func fillPrice(o Order, q Quote) (float64, bool) {
+	switch o.Type {
+	case orderOpen:
+		return q.Open, true
+	case orderMOC:
+		return q.Close, true
+	case orderLimit:
+		if o.Side == "buy" {
+			if q.Open <= o.LimitPrice {
+				return q.Open, true
+			}
+			return o.LimitPrice, q.Low <= o.LimitPrice
+		}
+		if q.Open >= o.LimitPrice {
+			return q.Open, true
+		}
+		return o.LimitPrice, q.High >= o.LimitPrice
+	}
+	return 0, false
+}
+
+// orderTerms describes the order types of s, as "open in, limit 2% 3d out",
+// or "5m bars +30m in, open out" for an intraday entry.
+func orderTerms(s Strategy) string {
+	term := func(typ string) string {
+		if typ != orderLimit {
+			return typ
+		}
+		days := s.LimitDays
+		if days < 1 {
+			days = 1
+		}
+		return fmt.Sprintf("limit %g%% %dd", s.LimitPct*100, days)
+	}
+	entry := term(s.entryOrder())
+	if s.EntryInterval != "" {
+		entry = fmt.Sprintf("%s bars +%dm", s.EntryInterval, s.EntryAfter)
+		if s.EntryUntil > s.EntryAfter {
+			entry += fmt.Sprintf("-%dm", s.EntryUntil)
+		}
+	}
+	return entry + " in, " + term(s.exitOrder()) + " out"
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFillPrice(t *testing.T) {
+	bar := Quote{Open: 10, High: 12, Low: 9, Close: 11, HasRange: true}
+	for _, c := range []struct {
+		name  string
+		order Order
+		price float64
+		fills bool
+	}{
+		{"open", Order{Type: orderOpen, Side: "buy"}, 10, true},
+		{"moc", Order{Type: orderMOC, Side: "sell"}, 11, true},
+		{"buy limit above the open", Order{Type: orderLimit, Side: "buy", LimitPrice: 10.5}, 10, true},
+		{"buy limit in the range", Order{Type: orderLimit, Side: "buy", LimitPrice: 9.5}, 9.5, true},
+		{"buy limit at the low", Order{Type: orderLimit, Side: "buy", LimitPrice: 9}, 9, true},
+		{"buy limit below the low", Order{Type: orderLimit, Side: "buy", LimitPrice: 8.5}, 8.5, false},
+		{"sell limit below the open", Order{Type: orderLimit, Side: "sell", LimitPrice: 9.5}, 10, true},
+		{"sell limit in the range", Order{Type: orderLimit, Side: "sell", LimitPrice: 11.5}, 11.5, true},
+		{"sell limit above the high", Order{Type: orderLimit, Side: "sell", LimitPrice: 12.5}, 12.5, false},
+		{"close", Order{Type: orderClose, Side: "buy"}, 0, false},
+	} {
+		price, fills := fillPrice(c.order, bar)
+		if price != c.price || fills != c.fills {
+			t.Errorf("%s: fillPrice = %g, %v, want %g, %v", c.name, price, fills, c.price, c.fills)
+		}
+	}
+}
+
+func TestEntryShift(t *testing.T) {
+	for early, want := range map[bool][]int{true: {-1, 0, 1}, false: {0, 1}} {
+		p := &perturbation{rand: rand.New(rand.NewSource(1)), Jitter: true}
+		seen := make(map[int]bool)
+		for i := 0; i < 300; i++ {
+			shift, drop := p.entryShift(early)
+			if drop {
+				t.Fatalf("entryShift(%v) dropped without Drop", early)
+			}
+			seen[shift] = true
+		}
+		for _, shift := range want {
+			delete(seen, shift)
+		}
+		if len(seen) > 0 {
+			t.Errorf("entryShift(%v) moved by %v, want only %v", early, seen, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// Machine readable output. Commands that take --format turn their results
+// into records, lists of named fields in a fixed order, and print them as an
+// aligned table, a JSON array of objects or csv with a header row. Field
+// names are the schema: add new ones at the end and don't rename them.
+
+var formatFlag = cli.StringFlag{Name: "format", Value: "table", Usage: "output as table, json or csv"}
+
+type field struct {
+	Name  string
+	Value interface{}
+}
+
+type record []field
+
+func checkFormat(format string) error {
+	switch format {
+	case "table", "json", "csv":
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, expected table, json or csv", format)
+}
+
+func writeRecords(w io.Writer, format string, records []record) error {
+	switch format {
+	case "json":
+		if records == nil {
+			records = []record{}
+		}
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		for i, r := range records {
+			if i == 0 {
+				cw.Write(fieldNames(r))
+			}
+			cw.Write(fieldStrings(r))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for i, r := range records {
+			if i == 0 {
+				fmt.Fprintln(tw, strings.Join(fieldNames(r), "\t"))
+			}
+			fmt.Fprintln(tw, strings.Join(fieldStrings(r), "\t"))
+		}
+		return tw.Flush()
+	}
+	return checkFormat(format)
+}
+
+// MarshalJSON writes r as an object with the fields in order.
+func (r record) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, f := range r {
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "%s:%s", name, value)
+	}
+	b.WriteString("}")
+	return []byte(b.String()), nil
+}
+
+func printRecords(format string, records []record) error {
+	return writeRecords(os.Stdout, format, records)
+}
+
+func fieldNames(r record) []string {
+	names := make([]string, len(r))
+	for i, f := range r {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func fieldStrings(r record) []string {
+	values := make([]string, len(r))
+	for i, f := range r {
+		switch v := f.Value.(type) {
+		case nil:
+			values[i] = ""
+		case float64:
+			values[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case []string:
+			values[i] = strings.Join(v, ";")
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
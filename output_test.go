@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteRecords(t *testing.T) {
+	records := []record{
+		{{"strategy", "low, slow"}, {"total", 20000.5}, {"trades", 3}, {"sectors", []string{"Energy", "Utilities"}}, {"error", nil}},
+		{{"strategy", "fast"}, {"total", -1.25}, {"trades", 0}, {"sectors", []string{}}, {"error", "no quotes"}},
+	}
+	for _, c := range []struct {
+		format  string
+		records []record
+		want    string
+	}{
+		{"json", records, `[
+  {
+    "strategy": "low, slow",
+    "total": 20000.5,
+    "trades": 3,
+    "sectors": [
+      "Energy",
+      "Utilities"
+    ],
+    "error": null
+  },
+  {
+    "strategy": "fast",
+    "total": -1.25,
+    "trades": 0,
+    "sectors": [],
+    "error": "no quotes"
+  }
+]
+`},
+		{"json", nil, "[]\n"},
+		{"csv", records, `strategy,total,trades,sectors,error
+"low, slow",20000.5,3,Energy;Utilities,
+fast,-1.25,0,,no quotes
+`},
+		{"csv", nil, ""},
+		{"table", records, `strategy   total    trades  sectors           error
+low, slow  20000.5  3       Energy;Utilities  
+fast       -1.25    0                         no quotes
+`},
+		{"table", nil, ""},
+	} {
+		var b strings.Builder
+		if err := writeRecords(&b, c.format, c.records); err != nil {
+			t.Fatalf("%s: %v", c.format, err)
+		}
+		if b.String() != c.want {
+			t.Errorf("%s of %d records:\n%s\nwant:\n%s", c.format, len(c.records), b.String(), c.want)
+		}
+	}
+	if err := writeRecords(&strings.Builder{}, "xml", records); err == nil {
+		t.Errorf("writeRecords accepted xml")
+	}
+}
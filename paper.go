@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Paper trading forward-tests a strategy on the days after it was set up.
+// Each paper account lives in paper/<name> with the strategy as it was when
+// the account was created, so later edits to the source don't change what
+// it trades. paper run trades every session that closed since the last run,
+// with the same rules as the backtest, placing the orders with a local
+// broker that fills them from the bars of the sessions after, as the
+// backtest does, or with --url through a broker speaking the Alpaca API,
+// which then holds the account while the paper one records its fills.
+
+const paperDir = "paper"
+
+type PaperAccount struct {
+	Name     string
+	Strategy Strategy
+	Created  time.Time
+	Start    time.Time
+	Account  Account
+	Fills    []Fill
+	Orders   []Order
+}
+
+// Fill is a trade, when it was recorded and the order it filled, if any.
+type Fill struct {
+	Trade
+	Recorded time.Time
+	OrderID  string
+}
+
+var paperCommands = []cli.Command{
+	{
+		Name:      "init",
+		Usage:     "open a paper account",
+		ArgsUsage: "NAME",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "strategy", Usage: "strategy to trade (default the first)"},
+			cli.Float64Flag{Name: "cash", Usage: "starting cash (default the strategy's)"},
+			cli.StringFlag{Name: "start", Usage: "first session to trade (default today)"},
+		},
+		Action: paperInit,
+	},
+	{
+		Name:      "run",
+		Usage:     "trade the sessions that closed since the last run",
+		ArgsUsage: "NAME...",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "url", Usage: "trade through the broker API at this URL, such as mockbroker's, rather than locally"},
+			cli.StringFlag{Name: "key", EnvVar: "APCA_API_KEY_ID", Usage: "API key ID"},
+			cli.StringFlag{Name: "secret", EnvVar: "APCA_API_SECRET_KEY", Usage: "API secret key"},
+		},
+		Action: paperRun,
+	},
+	{
+		Name:      "status",
+		Usage:     "print the positions and performance of a paper account",
+		ArgsUsage: "NAME",
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "backtest", Usage: "compare with a backtest over the same sessions"},
+			cli.IntFlag{Name: "fills", Value: 10, Usage: "number of recent fills to list"},
+		},
+		Action: paperStatus,
+	},
+}
+
+func paperFile(name string) string {
+	return fmt.Sprintf("%s/%s", paperDir, name)
+}
+
+func loadPaper(name string) (*PaperAccount, error) {
+	file := paperFile(name)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no paper account %q", name)
+	}
+	pa := new(PaperAccount)
+	if err := Load(file, pa); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if pa.Account.Portfolio == nil {
+		pa.Account.Portfolio = make(map[string]int)
+	}
+	if pa.Account.LastPrice == nil {
+		pa.Account.LastPrice = make(map[string]float64)
+	}
+	return pa, nil
+}
+
+func savePaper(pa *PaperAccount) error {
+	if err := os.MkdirAll(paperDir, 0755); err != nil {
+		return err
+	}
+	file := paperFile(pa.Name)
+	if err := Save(file+".tmp", pa); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func paperInit(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: paper init NAME")
+	}
+	name := c.Args().First()
+	if _, err := os.Stat(paperFile(name)); err == nil {
+		return fmt.Errorf("paper account %q exists", name)
+	}
+	s, err := findStrategy(c.String("strategy"))
+	if err != nil {
+		return err
+	}
+	if c.IsSet("cash") {
+		s.StartCash = c.Float64("cash")
+	}
+	start := midnight(time.Now())
+	if c.String("start") != "" {
+		if start, err = parseDate(c.String("start")); err != nil {
+			return err
+		}
+	}
+	start = SessionOffset(start, 0)
+	pa := &PaperAccount{
+		Name:     name,
+		Strategy: s,
+		Created:  time.Now(),
+		Start:    start,
+		Account:  *newAccount(s.StartCash),
+	}
+	pa.Account.Through = PreviousSession(start)
+	if err := savePaper(pa); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s with %.2f from %s\n", name, s.Name, s.StartCash, dateKey(start))
+	return nil
+}
+
+func paperRun(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("usage: paper run NAME...")
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	if _, err := loadMetadata(); err != nil {
+		return err
+	}
+	for _, name := range c.Args() {
+		pa, err := loadPaper(name)
+		if err != nil {
+			return err
+		}
+		if strategyHash(pa.Strategy) != strategyHash(mustFindStrategy(pa.Strategy.Name)) {
+			fmt.Printf("%s: strategy %q changed since the account was opened, trading it as it was\n", name, pa.Strategy.Name)
+		}
+		members, err := loadMembership(pa.Strategy.Index)
+		if err != nil {
+			return err
+		}
+		acct := &pa.Account
+		var b Broker = newLocalBroker("paper-"+name, acct, &pa.Orders, &pa.Fills)
+		remote := c.String("url") != ""
+		if remote {
+			b = newAlpacaBroker(c.String("url"), c.String("key"), c.String("secret"))
+		}
+		traded := 0
+		for _, d := range Sessions(SessionOffset(acct.Through, 1), time.Now()) {
+			if !sessionClosed(d) {
+				break
+			}
+			done, err := advanceBroker(ctx, b, d)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %v", name, dateKey(d), err)
+			}
+			for _, o := range done {
+				fmt.Printf("%s: %s %s %s %d %s %s at %.2f\n", name, dateKey(d), o.Type, o.Side, o.Shares, o.Ticker, o.Status, o.FilledPrice)
+			}
+			plan := acct.clone()
+			if remote {
+				if plan, err = brokerState(ctx, b, d); err != nil {
+					return fmt.Errorf("%s: %s: %v", name, dateKey(d), err)
+				}
+			}
+			before, resting, skipped := len(plan.Ledger), len(plan.Orders), plan.Skipped
+			if err := tradeDay(ctx, pa.Strategy, plan, members, d, nil); err != nil {
+				return fmt.Errorf("%s: %s: %v", name, dateKey(d), err)
+			}
+			for ticker, price := range plan.LastPrice {
+				acct.LastPrice[ticker] = price
+			}
+			acct.Skipped += plan.Skipped - skipped
+			orders := plan.Orders[resting:]
+			for _, t := range plan.Ledger[before:] {
+				if t.Action == "DELIST" {
+					if remote {
+						fmt.Printf("%s: %s %s delisted, left to the broker\n", name, dateKey(t.Date), t.Ticker)
+						continue
+					}
+					// not an order, the position is cashed out
+					acct.apply(t)
+					pa.Fills = append(pa.Fills, Fill{Trade: t, Recorded: time.Now()})
+					fmt.Printf("%s: %s DELIST %d %s at %.2f\n", name, dateKey(t.Date), t.Shares, t.Ticker, t.Price)
+					continue
+				}
+				orders = append(orders, orderFor(pa.Strategy, t))
+			}
+			for _, o := range orders {
+				placed, err := b.PlaceOrder(ctx, o)
+				if err != nil {
+					return fmt.Errorf("%s: %s: %v", name, dateKey(d), err)
+				}
+				if remote {
+					pa.Orders = append(pa.Orders, placed)
+				}
+				if placed.Status == orderNew {
+					fmt.Printf("%s: %s %s %s %d %s placed\n", name, dateKey(d), placed.Type, placed.Side, placed.Shares, placed.Ticker)
+				} else {
+					fmt.Printf("%s: %s %s %d %s %s at %.2f\n", name, dateKey(d), placed.Side, placed.Shares, placed.Ticker, placed.Status, placed.FilledPrice)
+				}
+			}
+			if remote {
+				if err := syncFills(ctx, b, pa, d); err != nil {
+					return fmt.Errorf("%s: %s: %v", name, dateKey(d), err)
+				}
+			}
+			acct.Through = d
+			traded++
+			// save every session so an interrupted catch-up isn't redone
+			if err := savePaper(pa); err != nil {
+				return err
+			}
+		}
+		if traded == 0 {
+			fmt.Printf("%s: up to date through %s\n", name, dateKey(acct.Through))
+			continue
+		}
+		fmt.Printf("%s: traded %d sessions through %s\n", name, traded, dateKey(acct.Through))
+	}
+	return nil
+}
+
+// syncFills records the fills b reports since the last one pa recorded as
+// trades on session date. Brokers take the time in whole seconds, so the
+// fills of that second come again and are skipped.
+func syncFills(ctx context.Context, b Broker, pa *PaperAccount, date time.Time) error {
+	since := pa.Created
+	recorded := make(map[string]bool)
+	for _, f := range pa.Fills {
+		since = f.Recorded
+		recorded[fmt.Sprint(f.OrderID, f.Recorded.UnixNano())] = true
+	}
+	fills, err := b.Fills(ctx, since)
+	if err != nil {
+		return err
+	}
+	for _, f := range fills {
+		if recorded[fmt.Sprint(f.OrderID, f.Time.UnixNano())] {
+			continue
+		}
+		t := Trade{Date: date, Ticker: f.Ticker, Action: strings.ToUpper(f.Side), Shares: f.Shares, Price: f.Price}
+		pa.Account.apply(t)
+		pa.Fills = append(pa.Fills, Fill{t, f.Time, f.OrderID})
+	}
+	return nil
+}
+
+// mustFindStrategy is the strategy named name, or an empty one if it is gone.
+func mustFindStrategy(name string) Strategy {
+	s, _ := findStrategy(name)
+	return s
+}
+
+func paperStatus(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: paper status NAME")
+	}
+	pa, err := loadPaper(c.Args().First())
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	acct := &pa.Account
+	s := pa.Strategy
+	fmt.Printf("%s: %s\n", pa.Name, s.Name)
+	if acct.Through.Before(pa.Start) {
+		fmt.Printf("    starts %s, nothing traded yet\n", dateKey(pa.Start))
+		return nil
+	}
+	values, err := holdingValues(ctx, acct, acct.Through)
+	if err != nil {
+		return err
+	}
+	total := calculateTotal(acct.Cash, values)
+	fmt.Printf("    %s - %s, %d sessions\n", dateKey(pa.Start), dateKey(acct.Through), len(Sessions(pa.Start, acct.Through.AddDate(0, 0, 1))))
+	fmt.Printf("    cash %14.2f\n", acct.Cash)
+	tickers := []string{}
+	for ticker := range values {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	for _, ticker := range tickers {
+		fmt.Printf("    %-6s %7d %14.2f\n", ticker, acct.Portfolio[ticker], values[ticker])
+	}
+	fmt.Printf("    total %13.2f  (%+.2f%%)\n", total, (total/s.StartCash-1)*100)
+
+	if c.Bool("backtest") {
+		bt := newAccount(s.StartCash)
+		if err := backtest(ctx, s, bt, pa.Start, acct.Through.AddDate(0, 0, 1), nil); err != nil {
+			return err
+		}
+		btValues, err := holdingValues(ctx, bt, acct.Through)
+		if err != nil {
+			return err
+		}
+		btTotal := calculateTotal(bt.Cash, btValues)
+		fmt.Printf("    backtest %10.2f  (%+.2f%%), %d trades against %d\n",
+			btTotal, (btTotal/s.StartCash-1)*100, len(bt.Ledger), len(acct.Ledger))
+	}
+
+	fills := pa.Fills
+	if n := c.Int("fills"); len(fills) > n {
+		fills = fills[len(fills)-n:]
+	}
+	if len(fills) > 0 {
+		fmt.Printf("    last %d of %d fills:\n", len(fills), len(pa.Fills))
+	}
+	for _, f := range fills {
+		fmt.Printf("    %s %-6s %-6s %7d %10.2f  recorded %s\n",
+			dateKey(f.Date), f.Action, f.Ticker, f.Shares, f.Price, f.Recorded.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Live progress of long backtests. Each running strategy has a row showing
+// the simulated date, trades, equity at the last prices seen, cache hits and
+// misses and an ETA; rows are redrawn in place on stderr while it is a
+// terminal, so they stay out of the results on stdout.
+
+type progress struct {
+	Name string
+
+	mu      sync.Mutex
+	started time.Time
+	first   time.Time
+	from    time.Time
+	to      time.Time
+	date    time.Time
+	trades  int
+	equity  float64
+	hits    int
+	misses  int
+}
+
+type progressKey struct{}
+
+// withProgress makes the backtests and cache lookups under ctx report to p.
+func withProgress(ctx context.Context, p *progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+func progressFrom(ctx context.Context) *progress {
+	p, _ := ctx.Value(progressKey{}).(*progress)
+	return p
+}
+
+// countCache records a cache hit or miss against the progress of ctx.
+func countCache(ctx context.Context, hit bool) {
+	p := progressFrom(ctx)
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if hit {
+		p.hits++
+	} else {
+		p.misses++
+	}
+}
+
+// span sets the dates the backtest runs between.
+func (p *progress) span(from, to time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.from, p.to = from, to
+}
+
+func (p *progress) update(acct *Account, date time.Time) {
+	if p == nil {
+		return
+	}
+	equity := acct.value()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started.IsZero() {
+		p.started, p.first = time.Now(), date
+		if p.from.IsZero() {
+			p.from = date
+		}
+	}
+	p.date = date
+	p.trades = len(acct.Ledger)
+	p.equity = equity
+}
+
+func (p *progress) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name := p.Name
+	if len(name) > 40 {
+		name = name[:37] + "..."
+	}
+	if p.date.IsZero() || !p.to.After(p.from) {
+		return fmt.Sprintf("%-40s starting", name)
+	}
+	done := float64(p.date.Sub(p.from)) / float64(p.to.Sub(p.from))
+	// resumed runs start part way, so the ETA goes by what this run covered
+	eta := "?"
+	if covered := p.date.Sub(p.first); covered > 0 {
+		elapsed := time.Since(p.started)
+		eta = (elapsed * time.Duration(p.to.Sub(p.date)/time.Hour) / time.Duration(covered/time.Hour)).Round(time.Second).String()
+	}
+	return fmt.Sprintf("%-40s %s %3.0f%%  %5d trades  %12.2f  cache %d/%d  eta %s",
+		name, dateKey(p.date), done*100, p.trades, p.equity, p.hits, p.hits+p.misses, eta)
+}
+
+// progressBoard draws the rows of the running strategies below everything
+// printed through it.
+type progressBoard struct {
+	mu    sync.Mutex
+	live  bool
+	rows  []*progress
+	drawn int
+	quit  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+}
+
+func newProgressBoard() *progressBoard {
+	b := &progressBoard{quit: make(chan struct{})}
+	if info, err := os.Stderr.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		b.live = true
+		b.wg.Add(1)
+		go b.run()
+	}
+	return b
+}
+
+func (b *progressBoard) add(name string) *progress {
+	p := &progress{Name: name}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rows = append(b.rows, p)
+	return p
+}
+
+// finish removes the row of p and prints the lines in its place.
+func (b *progressBoard) finish(p *progress, format string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, row := range b.rows {
+		if row == p {
+			b.rows = append(b.rows[:i], b.rows[i+1:]...)
+			break
+		}
+	}
+	b.clear()
+	fmt.Printf(format, args...)
+	b.draw()
+}
+
+func (b *progressBoard) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.quit:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			b.clear()
+			b.draw()
+			b.mu.Unlock()
+		}
+	}
+}
+
+func (b *progressBoard) stop() {
+	b.once.Do(func() { close(b.quit) })
+	b.wg.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clear()
+}
+
+func (b *progressBoard) clear() {
+	if b.drawn > 0 {
+		fmt.Fprintf(os.Stderr, "\033[%dA\033[J", b.drawn)
+	}
+	b.drawn = 0
+}
+
+func (b *progressBoard) draw() {
+	if !b.live || len(b.rows) == 0 {
+		return
+	}
+	lines := []string{}
+	for _, row := range b.rows {
+		lines = append(lines, row.String())
+	}
+	fmt.Fprintln(os.Stderr, strings.Join(lines, "\n"))
+	b.drawn = len(lines)
+}
+
+// interruptContext is cancelled by the first Ctrl-C; a second one kills the
+// process as usual.
+func interruptContext() (context.Context, func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/piquette/finance-go/chart"
+	"github.com/piquette/finance-go/datetime"
+)
+
+// Quotes caches the daily bars of a ticker, keyed by the trading date in
+// exchangeTZ (see dateKey). Missing records the dates that were fetched and
+// had no usable bar, so they are not fetched again. Bars cached before the
+// opens, highs and lows were kept only have a close and a change.
+type Quotes struct {
+	Ticker      string
+	ClosePrices map[string]float64
+	Changes     map[string]float64
+	Missing     map[string]bool
+	Opens       map[string]float64
+	Highs       map[string]float64
+	Lows        map[string]float64
+}
+
+// Quote is one day of a ticker. Without HasRange the open comes from the
+// change and the high and low are just the open and close.
+type Quote struct {
+	Date     time.Time
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Change   float64
+	HasRange bool
+}
+
+func quoteFile(ticker string) string {
+	return fmt.Sprintf("quotes/%s", ticker)
+}
+
+var (
+	fileLocksMu sync.Mutex
+	fileLocks   = make(map[string]*sync.Mutex)
+)
+
+// lockFile keeps the strategies of a pass from loading, fetching into and
+// saving the same cache file at once, so none of them loses what another
+// fetched. It returns the unlock.
+func lockFile(file string) func() {
+	fileLocksMu.Lock()
+	mu, ok := fileLocks[file]
+	if !ok {
+		mu = new(sync.Mutex)
+		fileLocks[file] = mu
+	}
+	fileLocksMu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (q *Quotes) quote(key string) (Quote, bool) {
+	closePrice, ok := q.ClosePrices[key]
+	if !ok {
+		return Quote{}, false
+	}
+	change, ok := q.Changes[key]
+	if !ok {
+		return Quote{}, false
+	}
+	date, _ := time.ParseInLocation(dateLayout, key, exchangeTZ)
+	bar := Quote{Date: date, Close: closePrice, Change: change}
+	open, okOpen := q.Opens[key]
+	high, okHigh := q.Highs[key]
+	low, okLow := q.Lows[key]
+	if okOpen && okHigh && okLow {
+		bar.Open, bar.High, bar.Low, bar.HasRange = open, high, low, true
+		return bar, true
+	}
+	bar.Open = closePrice / (1 + change)
+	bar.High, bar.Low = math.Max(bar.Open, closePrice), math.Min(bar.Open, closePrice)
+	return bar, true
+}
+
+// quoteForDate looks up the bar of ticker on date. ok is false if there was
+// no trading in it that day; err is set if the cache or the fetch failed.
+func quoteForDate(ctx context.Context, ticker string, date time.Time) (q Quote, ok bool, err error) {
+	if !IsTradingDay(date) {
+		return Quote{}, false, nil
+	}
+	if q, ok, known := sessionFrom(ctx).quote(ticker, date); known {
+		countCache(ctx, true)
+		return q, ok, nil
+	}
+	file := quoteFile(ticker)
+	defer lockFile(file)()
+	key := dateKey(date)
+	result, err := loadQuotes(file)
+	if err != nil {
+		return Quote{}, false, fmt.Errorf("%s: %v", file, err)
+	}
+	if q, ok := result.quote(key); ok {
+		countCache(ctx, true)
+		return q, true, nil
+	}
+	if result.Missing[key] {
+		countCache(ctx, true)
+		return Quote{}, false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return Quote{}, false, err
+	}
+	countCache(ctx, false)
+	date = midnight(date)
+	if err := fetchBars(file, ticker, result, date, date.AddDate(0, 0, 1)); err != nil {
+		return Quote{}, false, err
+	}
+	if q, ok := result.quote(key); ok {
+		return q, true, nil
+	}
+	if sessionClosed(date) {
+		result.Missing[key] = true
+		if err := Save(file, result); err != nil {
+			return Quote{}, false, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return Quote{}, false, nil
+}
+
+// barForDate is quoteForDate with the high and low of the day, fetching the
+// bar again if it was cached without them.
+func barForDate(ctx context.Context, ticker string, date time.Time) (Quote, bool, error) {
+	q, ok, err := quoteForDate(ctx, ticker, date)
+	if !ok || err != nil || q.HasRange {
+		return q, ok, err
+	}
+	if err := ctx.Err(); err != nil {
+		return Quote{}, false, err
+	}
+	file := quoteFile(ticker)
+	defer lockFile(file)()
+	result, err := loadQuotes(file)
+	if err != nil {
+		return Quote{}, false, fmt.Errorf("%s: %v", file, err)
+	}
+	date = midnight(date)
+	if err := fetchBars(file, ticker, result, date, date.AddDate(0, 0, 1)); err != nil {
+		return Quote{}, false, err
+	}
+	q, ok = result.quote(dateKey(date))
+	return q, ok, nil
+}
+
+// lastClose finds the most recent close of ticker on or before date, looking
+// back a week of sessions if that day has none.
+func lastClose(ctx context.Context, ticker string, date time.Time) (Quote, bool, error) {
+	q, ok, err := quoteForDate(ctx, ticker, date)
+	if ok || err != nil {
+		return q, ok, err
+	}
+	file := quoteFile(ticker)
+	defer lockFile(file)()
+	result, err := loadQuotes(file)
+	if err != nil {
+		return Quote{}, false, fmt.Errorf("%s: %v", file, err)
+	}
+	from := SessionOffset(date, -5)
+	if latestKey(result, dateKey(date)) < dateKey(from) {
+		if err := ctx.Err(); err != nil {
+			return Quote{}, false, err
+		}
+		if err := fetchBars(file, ticker, result, from, midnight(date).AddDate(0, 0, 1)); err != nil {
+			return Quote{}, false, err
+		}
+	}
+	key := latestKey(result, dateKey(date))
+	if key == "" {
+		return Quote{}, false, nil
+	}
+	q, _ = result.quote(key)
+	return q, true, nil
+}
+
+// latestKey is the latest cached date on or before key, or "".
+func latestKey(q *Quotes, key string) string {
+	keys := []string{}
+	for k := range q.ClosePrices {
+		if k <= key {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	return keys[len(keys)-1]
+}
+
+// fetchBars downloads the daily bars of ticker from start up to end into
+// result and saves it. Bars with no open and bars of a session still in
+// progress are left out.
+func fetchBars(file, ticker string, result *Quotes, start, end time.Time) error {
+	params := &chart.Params{
+		Symbol:   ticker,
+		Interval: datetime.OneDay,
+		Start:    datetime.New(&start),
+		End:      datetime.New(&end),
+	}
+	iter := chart.Get(params)
+	for iter.Next() {
+		b := iter.Bar()
+		date := time.Unix(int64(b.Timestamp), 0)
+		if b.Open.Sign() == 0 || !sessionClosed(date) {
+			continue
+		}
+		key := dateKey(date)
+		change, _ := b.Close.Sub(b.Open).Div(b.Open).Float64()
+		closePrice, _ := b.Close.Float64()
+		result.Changes[key] = change
+		result.ClosePrices[key] = closePrice
+		result.Opens[key], _ = b.Open.Float64()
+		result.Highs[key], _ = b.High.Float64()
+		result.Lows[key], _ = b.Low.Float64()
+		delete(result.Missing, key)
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("fetching %s: %v", ticker, err)
+	}
+	result.Ticker = ticker
+	if err := Save(file, result); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return nil
+}
+
+// ensureBars fills the cache of ticker with every session from start up to
+// end that it has no bar for yet, in one fetch. Sessions still without one
+// afterwards are marked Missing.
+func ensureBars(ctx context.Context, ticker string, start, end time.Time) (*Quotes, error) {
+	file := quoteFile(ticker)
+	defer lockFile(file)()
+	result, err := loadQuotes(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	missing := []time.Time{}
+	for _, d := range Sessions(start, end) {
+		key := dateKey(d)
+		if _, ok := result.ClosePrices[key]; !ok && !result.Missing[key] && sessionClosed(d) {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) == 0 {
+		countCache(ctx, true)
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	countCache(ctx, false)
+	if err := fetchBars(file, ticker, result, missing[0], missing[len(missing)-1].AddDate(0, 0, 1)); err != nil {
+		return nil, err
+	}
+	for _, d := range missing {
+		key := dateKey(d)
+		if _, ok := result.ClosePrices[key]; !ok {
+			result.Missing[key] = true
+		}
+	}
+	if err := Save(file, result); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return result, nil
+}
+
+// closeSeries looks up the latest close on or before a date.
+type closeSeries struct {
+	quotes *Quotes
+	keys   []string
+}
+
+func newCloseSeries(q *Quotes) closeSeries {
+	keys := make([]string, 0, len(q.ClosePrices))
+	for k := range q.ClosePrices {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return closeSeries{q, keys}
+}
+
+func (s closeSeries) at(key string) (float64, bool) {
+	return s.since("", key)
+}
+
+// since is the latest close from one on or after from up to key.
+func (s closeSeries) since(from, key string) (float64, bool) {
+	i := sort.SearchStrings(s.keys, key)
+	if i < len(s.keys) && s.keys[i] == key {
+		return s.quotes.ClosePrices[key], true
+	}
+	if i == 0 || s.keys[i-1] < from {
+		return 0, false
+	}
+	return s.quotes.ClosePrices[s.keys[i-1]], true
+}
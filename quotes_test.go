@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// cacheBars saves the bars to the quote cache of ticker as if they had been
+// fetched, and marks the missing dates as fetched without a bar.
+func cacheBars(t *testing.T, ticker string, bars []Quote, missing ...string) {
+	t.Helper()
+	if err := os.MkdirAll("quotes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	q, err := loadQuotes(quoteFile(ticker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Ticker = ticker
+	for _, b := range bars {
+		key := dateKey(b.Date)
+		q.ClosePrices[key], q.Changes[key] = b.Close, b.Change
+		if b.HasRange {
+			q.Opens[key], q.Highs[key], q.Lows[key] = b.Open, b.High, b.Low
+		}
+	}
+	for _, key := range missing {
+		q.Missing[key] = true
+	}
+	if err := Save(quoteFile(ticker), q); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLastClose(t *testing.T) {
+	inTempDir(t)
+	cacheBars(t, "AAA", []Quote{
+		{Date: day(t, "2021-03-04"), Close: 10, Change: 0.01},
+		{Date: day(t, "2021-03-05"), Close: 11, Change: 0.02},
+		{Date: day(t, "2021-03-09"), Close: 12, Change: 0.03},
+	}, "2021-03-08")
+	ctx := context.Background()
+	for _, c := range []struct {
+		date      string
+		quote     bool
+		lastClose float64
+	}{
+		{"2021-03-05", true, 11},
+		{"2021-03-06", false, 11}, // Saturday
+		{"2021-03-07", false, 11},
+		{"2021-03-08", false, 11}, // fetched before, no bar
+		{"2021-03-09", true, 12},
+	} {
+		q, ok, err := quoteForDate(ctx, "AAA", day(t, c.date))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.quote || ok && q.Close != c.lastClose {
+			t.Errorf("quoteForDate(%s) = %+v, %v, want %v", c.date, q, ok, c.quote)
+		}
+		q, ok, err = lastClose(ctx, "AAA", day(t, c.date))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || q.Close != c.lastClose {
+			t.Errorf("lastClose(%s) = %+v, %v, want %g", c.date, q, ok, c.lastClose)
+		}
+	}
+}
+
+func TestHoldingValues(t *testing.T) {
+	inTempDir(t)
+	cacheBars(t, "AAA", []Quote{{Date: day(t, "2021-03-05"), Close: 11, Change: 0.02}})
+	acct := newAccount(100)
+	acct.Portfolio["AAA"], acct.LastPrice["AAA"] = 10, 9
+	values, err := holdingValues(context.Background(), acct, day(t, "2021-03-06"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["AAA"] != 110 {
+		t.Errorf("AAA valued at %g, want the last close 110", values["AAA"])
+	}
+}
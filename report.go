@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HTML reports of simulation runs. The report is one file with the charts
+// drawn as inline SVG, so it can be mailed around and opened anywhere. The
+// equity curves value the holdings at every session's close, fetching the
+// bars of each ticker over the time it was held.
+
+var chartColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#9467bd", "#ff7f0e", "#8c564b", "#e377c2", "#17becf", "#bcbd22"}
+
+const benchmarkColor = "#7f7f7f"
+
+type series struct {
+	Name   string
+	Color  string
+	Dates  []time.Time
+	Values []float64
+}
+
+// roundTrip is a position from its first buy until it was sold.
+type roundTrip struct {
+	Ticker   string
+	Opened   time.Time
+	Closed   time.Time
+	Cost     float64
+	Proceeds float64
+}
+
+func (t roundTrip) PnL() float64       { return t.Proceeds - t.Cost }
+func (t roundTrip) ReturnPct() float64 { return t.PnL() / t.Cost * 100 }
+
+type heatCell struct {
+	Text  string
+	Style template.CSS
+}
+
+type heatRow struct {
+	Year  int
+	Cells []heatCell
+}
+
+type reportSection struct {
+	Name        string
+	Total       float64
+	CAGR        float64
+	MaxDrawdown float64
+	Trades      []Trade
+	Partial     bool
+	Window      string
+	Equity      template.HTML
+	Drawdown    template.HTML
+	Heatmap     []heatRow
+	Winners     []roundTrip
+	Losers      []roundTrip
+	Params      [][2]string
+}
+
+type reportData struct {
+	Generated string
+	Version   string
+	Benchmark string
+	Overview  template.HTML
+	Sections  []reportSection
+}
+
+// writeReport writes the HTML report of the simulated strategies and the
+// runs recorded for them to path.
+func writeReport(ctx context.Context, path, benchmark string, results []Strategy, runs []Run) error {
+	data := reportData{
+		Generated: time.Now().Format("2006-01-02 15:04"),
+		Version:   codeVersion(),
+		Benchmark: benchmark,
+	}
+	overview := []series{}
+	var first, last time.Time
+	for i, s := range results {
+		dates, values, err := dailyEquity(ctx, s)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.Name, err)
+		}
+		if len(dates) == 0 {
+			continue
+		}
+		color := chartColors[i%len(chartColors)]
+		curve := series{s.Name, color, dates, values}
+		bench, err := benchmarkCurve(ctx, benchmark, s.StartCash, dates)
+		if err != nil {
+			return err
+		}
+		drawdown := drawdownCurve(curve)
+		data.Sections = append(data.Sections, reportSection{
+			Name:        s.Name,
+			Total:       s.Total,
+			CAGR:        s.growthRate() * 100,
+			MaxDrawdown: -minimum(drawdown.Values),
+			Trades:      sortedLedger(s.Ledger),
+			Partial:     s.Partial,
+			Window:      dateKey(s.Start) + " - " + dateKey(s.Through),
+			Equity:      lineChart([]series{curve, bench}, "%.0f"),
+			Drawdown:    lineChart([]series{drawdown}, "%.0f%%"),
+			Heatmap:     monthlyReturns(curve, s.StartCash),
+			Params:      runRows(runs[i]),
+		})
+		sec := &data.Sections[len(data.Sections)-1]
+		sec.Winners, sec.Losers = topTrips(roundTrips(s.Ledger), 10)
+
+		overview = append(overview, growth(curve, s.StartCash))
+		if first.IsZero() || dates[0].Before(first) {
+			first = dates[0]
+		}
+		if dates[len(dates)-1].After(last) {
+			last = dates[len(dates)-1]
+		}
+	}
+	if len(overview) > 0 {
+		bench, err := benchmarkCurve(ctx, benchmark, 1, Sessions(first, last.AddDate(0, 0, 1)))
+		if err != nil {
+			return err
+		}
+		data.Overview = lineChart(append(overview, bench), "%.1fx")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dailyEquity values the account of s at the close of every session it ran.
+// Holdings without a close that day count at their last known price.
+func dailyEquity(ctx context.Context, s Strategy) ([]time.Time, []float64, error) {
+	ledger := sortedLedger(s.Ledger)
+	end := s.Through.AddDate(0, 0, 1)
+	held := make(map[string][2]time.Time)
+	open := make(map[string]bool)
+	for _, t := range ledger {
+		h, ok := held[t.Ticker]
+		if !ok {
+			h[0] = t.Date
+		}
+		h[1] = t.Date
+		held[t.Ticker] = h
+		open[t.Ticker] = t.Action == "BUY"
+	}
+	closes := make(map[string]closeSeries)
+	for ticker, h := range held {
+		to := h[1].AddDate(0, 0, 1)
+		if open[ticker] {
+			to = end
+		}
+		q, err := ensureBars(ctx, ticker, h[0], to)
+		if err != nil {
+			return nil, nil, err
+		}
+		closes[ticker] = newCloseSeries(q)
+	}
+
+	cash := s.StartCash
+	shares := make(map[string]int)
+	price := make(map[string]float64)
+	dates, values := []time.Time{}, []float64{}
+	n := 0
+	for _, d := range Sessions(s.Start, end) {
+		key := dateKey(d)
+		for ; n < len(ledger) && dateKey(ledger[n].Date) <= key; n++ {
+			t := ledger[n]
+			cash += t.Cash()
+			price[t.Ticker] = t.Price
+			if t.Action == "BUY" {
+				shares[t.Ticker] += t.Shares
+			} else {
+				delete(shares, t.Ticker)
+			}
+		}
+		// a close from more than a week back means the ticker stopped trading
+		stale := dateKey(SessionOffset(d, -5))
+		equity := cash
+		for ticker, amount := range shares {
+			p := price[ticker]
+			if c, ok := closes[ticker].since(stale, key); ok {
+				p = c
+			}
+			equity += float64(amount) * p
+		}
+		dates = append(dates, d)
+		values = append(values, equity)
+	}
+	return dates, values, nil
+}
+
+// benchmarkCurve is what cash put into ticker on the first date grew to.
+func benchmarkCurve(ctx context.Context, ticker string, cash float64, dates []time.Time) (series, error) {
+	curve := series{Name: ticker, Color: benchmarkColor}
+	if len(dates) == 0 {
+		return curve, nil
+	}
+	q, err := ensureBars(ctx, ticker, dates[0], dates[len(dates)-1].AddDate(0, 0, 1))
+	if err != nil {
+		return curve, err
+	}
+	closes := newCloseSeries(q)
+	base := 0.0
+	for _, d := range dates {
+		c, ok := closes.at(dateKey(d))
+		if !ok {
+			continue
+		}
+		if base == 0 {
+			base = c
+		}
+		curve.Dates = append(curve.Dates, d)
+		curve.Values = append(curve.Values, cash*c/base)
+	}
+	return curve, nil
+}
+
+func growth(s series, cash float64) series {
+	g := series{Name: s.Name, Color: s.Color, Dates: s.Dates}
+	for _, v := range s.Values {
+		g.Values = append(g.Values, v/cash)
+	}
+	return g
+}
+
+// drawdownCurve is how far below its running peak s is, in percent.
+func drawdownCurve(s series) series {
+	d := series{Name: "drawdown", Color: s.Color, Dates: s.Dates}
+	peak := 0.0
+	for _, v := range s.Values {
+		peak = math.Max(peak, v)
+		dd := 0.0
+		if peak > 0 {
+			dd = (v/peak - 1) * 100
+		}
+		d.Values = append(d.Values, dd)
+	}
+	return d
+}
+
+// monthlyReturns is the return of each calendar month, a row per year with
+// the year's return last.
+func monthlyReturns(s series, cash float64) []heatRow {
+	rows := []heatRow{}
+	prev, yearStart := cash, cash
+	for i, d := range s.Dates {
+		lastOfMonth := i == len(s.Dates)-1 || s.Dates[i+1].Month() != d.Month()
+		if !lastOfMonth {
+			continue
+		}
+		if len(rows) == 0 || rows[len(rows)-1].Year != d.Year() {
+			rows = append(rows, heatRow{Year: d.Year(), Cells: make([]heatCell, 13)})
+		}
+		row := &rows[len(rows)-1]
+		row.Cells[d.Month()-1] = newHeatCell(s.Values[i]/prev - 1)
+		prev = s.Values[i]
+		lastOfYear := i == len(s.Dates)-1 || s.Dates[i+1].Year() != d.Year()
+		if lastOfYear {
+			row.Cells[12] = newHeatCell(s.Values[i]/yearStart - 1)
+			yearStart = s.Values[i]
+		}
+	}
+	return rows
+}
+
+func newHeatCell(r float64) heatCell {
+	return heatCell{
+		Text:  fmt.Sprintf("%+.1f%%", r*100),
+		Style: template.CSS("background: " + heatColor(r)),
+	}
+}
+
+// heatColor shades returns green and losses red, the deeper the further
+// they are from zero up to 10%.
+func heatColor(r float64) string {
+	rgb, alpha := heatRGBA(r)
+	return fmt.Sprintf("rgba(%d, %d, %d, %.2f)", rgb[0], rgb[1], rgb[2], alpha)
+}
+
+func heatRGBA(r float64) ([3]uint8, float64) {
+	alpha := math.Min(math.Abs(r)/0.1, 1)*0.8 + 0.1
+	if r < 0 {
+		return [3]uint8{214, 39, 40}, alpha
+	}
+	return [3]uint8{46, 160, 67}, alpha
+}
+
+func sortedLedger(ledger []Trade) []Trade {
+	sorted := append([]Trade(nil), ledger...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	return sorted
+}
+
+// roundTrips pairs the buys of each ticker with the sale that closed them.
+// Positions still held are left out.
+func roundTrips(ledger []Trade) []roundTrip {
+	open := make(map[string]*roundTrip)
+	trips := []roundTrip{}
+	for _, t := range sortedLedger(ledger) {
+		trip, ok := open[t.Ticker]
+		if t.Action == "BUY" {
+			if !ok {
+				trip = &roundTrip{Ticker: t.Ticker, Opened: t.Date}
+				open[t.Ticker] = trip
+			}
+			trip.Cost -= t.Cash()
+			continue
+		}
+		if !ok {
+			continue
+		}
+		trip.Closed, trip.Proceeds = t.Date, t.Cash()
+		trips = append(trips, *trip)
+		delete(open, t.Ticker)
+	}
+	return trips
+}
+
+// topTrips returns the n best and n worst trips by profit.
+func topTrips(trips []roundTrip, n int) (winners, losers []roundTrip) {
+	sort.Slice(trips, func(i, j int) bool { return trips[i].PnL() > trips[j].PnL() })
+	for _, t := range trips {
+		if len(winners) == n || t.PnL() <= 0 {
+			break
+		}
+		winners = append(winners, t)
+	}
+	for i := len(trips) - 1; i >= 0 && len(losers) < n && trips[i].PnL() < 0; i-- {
+		losers = append(losers, trips[i])
+	}
+	return winners, losers
+}
+
+// lineChart draws the series as an SVG chart over their common date range,
+// labelling the y axis with format.
+func lineChart(all []series, format string) template.HTML {
+	const width, height, left, right, top, bottom = 900.0, 320.0, 70.0, 10.0, 10.0, 40.0
+	var first, last time.Time
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range all {
+		for i, d := range s.Dates {
+			if first.IsZero() || d.Before(first) {
+				first = d
+			}
+			if d.After(last) {
+				last = d
+			}
+			lo, hi = math.Min(lo, s.Values[i]), math.Max(hi, s.Values[i])
+		}
+	}
+	if first.IsZero() {
+		return ""
+	}
+	if hi == lo {
+		hi, lo = hi+1, lo-1
+	}
+	span := last.Sub(first).Hours()
+	if span == 0 {
+		span = 1
+	}
+	x := func(d time.Time) float64 { return left + (width-left-right)*d.Sub(first).Hours()/span }
+	y := func(v float64) float64 { return top + (height-top-bottom)*(hi-v)/(hi-lo) }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %.0f %.0f" width="100%%" xmlns="http://www.w3.org/2000/svg" font-size="11">`, width, height)
+	for i := 0; i <= 4; i++ {
+		v := lo + (hi-lo)*float64(i)/4
+		fmt.Fprintf(&b, `<line x1="%.0f" x2="%.0f" y1="%.1f" y2="%.1f" stroke="#ddd"/>`, left, width-right, y(v), y(v))
+		fmt.Fprintf(&b, `<text x="%.0f" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`, left-6, y(v), html.EscapeString(fmt.Sprintf(format, v)))
+	}
+	for year := first.Year() + 1; year <= last.Year(); year++ {
+		d := time.Date(year, 1, 1, 0, 0, 0, 0, exchangeTZ)
+		fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%.0f" y2="%.0f" stroke="#eee"/>`, x(d), x(d), top, height-bottom)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.0f" text-anchor="middle">%d</text>`, x(d), height-bottom+16, year)
+	}
+	for i, s := range all {
+		points := make([]string, len(s.Dates))
+		for j, d := range s.Dates {
+			points[j] = fmt.Sprintf("%.1f,%.1f", x(d), y(s.Values[j]))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, s.Color, strings.Join(points, " "))
+		fmt.Fprintf(&b, `<rect x="%.0f" y="%d" width="10" height="10" fill="%s"/>`, left+10, int(top)+4+14*i, s.Color)
+		fmt.Fprintf(&b, `<text x="%.0f" y="%d">%s</text>`, left+24, int(top)+13+14*i, html.EscapeString(s.Name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date":  dateKey,
+	"money": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"pct":   func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+	"months": func() []string {
+		return []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec", "Year"}
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Simulation report {{.Generated}}</title>
+<style>
+body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 960px; color: #222; }
+h2 { margin-top: 2.5em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; margin: 1em 0; font-size: 13px; }
+th, td { padding: 3px 8px; text-align: right; }
+th { background: #f3f3f3; }
+td.l, th.l { text-align: left; }
+.heat td { min-width: 3.5em; }
+.pair { display: flex; gap: 2em; }
+</style>
+</head>
+<body>
+<h1>Simulation report</h1>
+<p>Generated {{.Generated}}, code version {{.Version}}, benchmark {{.Benchmark}}.</p>
+<table>
+<tr><th class="l">strategy</th><th>window</th><th>total</th><th>cagr</th><th>max drawdown</th><th>trades</th></tr>
+{{range .Sections}}<tr><td class="l">{{.Name}}{{if .Partial}} (partial){{end}}</td><td>{{.Window}}</td><td>{{money .Total}}</td><td>{{pct .CAGR}}</td><td>{{pct .MaxDrawdown}}</td><td>{{len .Trades}}</td></tr>
+{{end}}</table>
+<h3>Growth of 1 vs {{.Benchmark}}</h3>
+{{.Overview}}
+{{range .Sections}}
+<h2>{{.Name}}</h2>
+<h3>Equity</h3>
+{{.Equity}}
+<h3>Drawdown</h3>
+{{.Drawdown}}
+<h3>Monthly returns</h3>
+<table class="heat">
+<tr><th></th>{{range months}}<th>{{.}}</th>{{end}}</tr>
+{{range .Heatmap}}<tr><th>{{.Year}}</th>{{range .Cells}}<td style="{{.Style}}">{{.Text}}</td>{{end}}</tr>
+{{end}}</table>
+<div class="pair">
+<div>
+<h3>Top winners</h3>
+<table>
+<tr><th class="l">ticker</th><th>opened</th><th>closed</th><th>pnl</th><th>return</th></tr>
+{{range .Winners}}<tr><td class="l">{{.Ticker}}</td><td>{{date .Opened}}</td><td>{{date .Closed}}</td><td>{{money .PnL}}</td><td>{{pct .ReturnPct}}</td></tr>
+{{end}}</table>
+</div>
+<div>
+<h3>Top losers</h3>
+<table>
+<tr><th class="l">ticker</th><th>opened</th><th>closed</th><th>pnl</th><th>return</th></tr>
+{{range .Losers}}<tr><td class="l">{{.Ticker}}</td><td>{{date .Opened}}</td><td>{{date .Closed}}</td><td>{{money .PnL}}</td><td>{{pct .ReturnPct}}</td></tr>
+{{end}}</table>
+</div>
+</div>
+<h3>Parameters</h3>
+<table>
+{{range .Params}}<tr><th class="l">{{index . 0}}</th><td class="l">{{index . 1}}</td></tr>
+{{end}}</table>
+<details>
+<summary>{{len .Trades}} trades</summary>
+<table>
+<tr><th class="l">date</th><th class="l">ticker</th><th class="l">action</th><th>shares</th><th>price</th></tr>
+{{range .Trades}}<tr><td class="l">{{date .Date}}</td><td class="l">{{.Ticker}}</td><td class="l">{{.Action}}</td><td>{{.Shares}}</td><td>{{money .Price}}</td></tr>
+{{end}}</table>
+</details>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Every simulation run is recorded as one JSON line in results/runs.jsonl,
+// with its ledger written next to it as results/ledgers/<id>.csv. A run
+// keeps the strategy it ran, the data window, the code version and the
+// metrics, so past numbers can be compared without pasting them into source.
+
+const (
+	resultsDir  = "results"
+	resultsFile = "results/runs.jsonl"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = ""
+
+type Run struct {
+	ID          string
+	Time        time.Time
+	Version     string
+	Hash        string
+	Strategy    Strategy
+	Start       time.Time
+	End         time.Time
+	Total       float64
+	CAGR        float64
+	MaxDrawdown float64
+	Trades      int
+	Skipped     int
+	Unfilled    int
+	Partial     bool
+	SectorPnL   map[string]float64
+	LedgerPath  string
+}
+
+var resultsCommands = []cli.Command{
+	{
+		Name:   "list",
+		Usage:  "list past runs",
+		Flags:  []cli.Flag{cli.StringFlag{Name: "strategy", Usage: "only runs of the named strategy"}},
+		Action: resultsList,
+	},
+	{
+		Name:      "show",
+		Usage:     "print a run",
+		ArgsUsage: "ID",
+		Action:    resultsShow,
+	},
+	{
+		Name:      "compare",
+		Usage:     "print runs side by side",
+		ArgsUsage: "ID ID...",
+		Action:    resultsCompare,
+	},
+	{
+		Name:      "delete",
+		Usage:     "delete runs and their ledgers",
+		ArgsUsage: "ID...",
+		Action:    resultsDelete,
+	},
+}
+
+// codeVersion is the version linked in, or the VCS revision the binary was
+// built from.
+func codeVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	rev, dirty := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if rev == "" {
+		return "unknown"
+	}
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	if dirty {
+		rev += "+dirty"
+	}
+	return rev
+}
+
+// newRun describes the result of simulating s.
+func newRun(s Strategy) Run {
+	now := time.Now()
+	hash := strategyHash(s)
+	def := s.definition()
+	def.Name = s.Name
+	return Run{
+		ID:          now.Format("20060102-150405") + "-" + hash[:6],
+		Time:        now,
+		Version:     codeVersion(),
+		Hash:        hash,
+		Strategy:    def,
+		Start:       s.Start,
+		End:         s.Through,
+		Total:       s.Total,
+		CAGR:        s.growthRate(),
+		MaxDrawdown: maxDrawdown(append([]float64{s.StartCash}, s.Equity...)),
+		Trades:      len(s.Ledger),
+		Skipped:     s.Skipped,
+		Unfilled:    s.Unfilled,
+		Partial:     s.Partial,
+		SectorPnL:   s.SectorPnL,
+	}
+}
+
+// recordRun writes the ledger of r and appends r to the results, returning
+// it with its LedgerPath set. An ID already taken, by a run of the same
+// strategy in the same second, gets a counter appended.
+func recordRun(r Run, ledger []Trade) (Run, error) {
+	dir := filepath.Join(resultsDir, "ledgers")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return r, err
+	}
+	id := r.ID
+	for n := 2; ; n++ {
+		r.LedgerPath = filepath.Join(dir, r.ID+".csv")
+		err := writeLedger(r.LedgerPath, ledger)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return r, err
+		}
+		r.ID = fmt.Sprintf("%s-%d", id, n)
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return r, err
+	}
+	f, err := os.OpenFile(resultsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return r, err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return r, err
+	}
+	return r, f.Close()
+}
+
+// writeLedger writes ledger to a new file at path, failing if it exists.
+func writeLedger(path string, ledger []Trade) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"date", "ticker", "action", "shares", "price"})
+	for _, t := range ledger {
+		w.Write([]string{
+			dateKey(t.Date),
+			t.Ticker,
+			t.Action,
+			strconv.Itoa(t.Shares),
+			strconv.FormatFloat(t.Price, 'f', -1, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadRuns reads every recorded run, oldest first.
+func loadRuns() ([]Run, error) {
+	f, err := os.Open(resultsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	runs := []Run{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var r Run
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", resultsFile, n, err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, scanner.Err()
+}
+
+// findRun looks a run up by ID or unique ID prefix.
+func findRun(runs []Run, id string) (Run, error) {
+	found := []Run{}
+	for _, r := range runs {
+		if r.ID == id {
+			return r, nil
+		}
+		if strings.HasPrefix(r.ID, id) {
+			found = append(found, r)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Run{}, fmt.Errorf("no run %q", id)
+	case 1:
+		return found[0], nil
+	}
+	return Run{}, fmt.Errorf("run %q is ambiguous", id)
+}
+
+func resultsList(c *cli.Context) error {
+	runs, err := loadRuns()
+	if err != nil {
+		return err
+	}
+	for _, r := range runs {
+		if c.String("strategy") != "" && r.Strategy.Name != c.String("strategy") {
+			continue
+		}
+		partial := ""
+		if r.Partial {
+			partial = "  partial"
+		}
+		fmt.Printf("%-22s %s  %-12s %14.2f %8.2f%% %7.2f%%  %s%s\n",
+			r.ID, r.Time.Format("2006-01-02 15:04"), r.Version, r.Total, r.CAGR*100, r.MaxDrawdown*100, r.Strategy.Name, partial)
+	}
+	return nil
+}
+
+func resultsShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: results show ID")
+	}
+	runs, err := loadRuns()
+	if err != nil {
+		return err
+	}
+	r, err := findRun(runs, c.Args().First())
+	if err != nil {
+		return err
+	}
+	for _, row := range runRows(r) {
+		fmt.Printf("%-16s %s\n", row[0], row[1])
+	}
+	fmt.Print(formatSectorPnL(r.SectorPnL))
+	return nil
+}
+
+func resultsCompare(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return fmt.Errorf("usage: results compare ID ID...")
+	}
+	runs, err := loadRuns()
+	if err != nil {
+		return err
+	}
+	table := [][][2]string{}
+	for _, id := range c.Args() {
+		r, err := findRun(runs, id)
+		if err != nil {
+			return err
+		}
+		table = append(table, runRows(r))
+	}
+	for i := range table[0] {
+		line := fmt.Sprintf("%-16s", table[0][i][0])
+		for _, rows := range table {
+			line += fmt.Sprintf(" %-24s", rows[i][1])
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+func resultsDelete(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("usage: results delete ID...")
+	}
+	runs, err := loadRuns()
+	if err != nil {
+		return err
+	}
+	doomed := make(map[string]bool)
+	for _, id := range c.Args() {
+		r, err := findRun(runs, id)
+		if err != nil {
+			return err
+		}
+		doomed[r.ID] = true
+	}
+	tmp := resultsFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	kept := []Run{}
+	for _, r := range runs {
+		if doomed[r.ID] {
+			continue
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+		kept = append(kept, r)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, resultsFile); err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, r := range runs {
+		if doomed[r.ID] {
+			if r.LedgerPath != "" {
+				os.Remove(r.LedgerPath)
+			}
+			ids = append(ids, r.ID)
+		}
+	}
+	sort.Strings(ids)
+	fmt.Printf("deleted %s, %d runs left\n", strings.Join(ids, ", "), len(kept))
+	return nil
+}
+
+// runRecords lists runs in the order of the strategies they ran, for
+// --format output.
+func runRecords(runs []Run) []record {
+	order := make(map[string]int)
+	for i, s := range strategies {
+		order[s.Name] = i
+	}
+	sorted := append([]Run(nil), runs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return order[sorted[i].Strategy.Name] < order[sorted[j].Strategy.Name] })
+	records := []record{}
+	for _, r := range sorted {
+		s := r.Strategy
+		records = append(records, record{
+			{"strategy", s.Name},
+			{"index", s.Index},
+			{"years", s.NumYears},
+			{"threshold_pct", s.ThresholdPct},
+			{"start_cash", s.StartCash},
+			{"increment", s.Increment},
+			{"increment_pct", s.IncrementPct},
+			{"include_sectors", nonNil(s.IncludeSectors)},
+			{"exclude_sectors", nonNil(s.ExcludeSectors)},
+			{"max_sector_pct", s.MaxSectorPct},
+			{"entry_order", s.entryOrder()},
+			{"exit_order", s.exitOrder()},
+			{"limit_pct", s.LimitPct},
+			{"limit_days", s.LimitDays},
+			{"entry_interval", s.EntryInterval},
+			{"entry_after", s.EntryAfter},
+			{"entry_until", s.EntryUntil},
+			{"start", dateKey(r.Start)},
+			{"end", dateKey(r.End)},
+			{"total", r.Total},
+			{"cagr", r.CAGR},
+			{"max_drawdown", r.MaxDrawdown},
+			{"trades", r.Trades},
+			{"skipped", r.Skipped},
+			{"unfilled", r.Unfilled},
+			{"partial", r.Partial},
+			{"run_id", r.ID},
+		})
+	}
+	return records
+}
+
+// nonNil keeps empty lists as [] rather than null in json.
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// runRows are the labelled fields of r in display order.
+func runRows(r Run) [][2]string {
+	s := r.Strategy
+	sectors := func(list []string) string {
+		if len(list) == 0 {
+			return "-"
+		}
+		return strings.Join(list, ",")
+	}
+	return [][2]string{
+		{"id", r.ID},
+		{"time", r.Time.Format("2006-01-02 15:04:05")},
+		{"version", r.Version},
+		{"strategy", s.Name},
+		{"hash", r.Hash},
+		{"index", s.Index},
+		{"years", strconv.Itoa(s.NumYears)},
+		{"threshold", fmt.Sprintf("%g%%", s.ThresholdPct*100)},
+		{"start cash", fmt.Sprintf("%.2f", s.StartCash)},
+		{"increment", fmt.Sprintf("%.2f", s.Increment)},
+		{"increment pct", fmt.Sprintf("%g%%", s.IncrementPct*100)},
+		{"include", sectors(s.IncludeSectors)},
+		{"exclude", sectors(s.ExcludeSectors)},
+		{"max sector", fmt.Sprintf("%g%%", s.MaxSectorPct*100)},
+		{"orders", orderTerms(s)},
+		{"window", dateKey(r.Start) + " - " + dateKey(r.End)},
+		{"partial", strconv.FormatBool(r.Partial)},
+		{"total", fmt.Sprintf("%.2f", r.Total)},
+		{"cagr", fmt.Sprintf("%.2f%%", r.CAGR*100)},
+		{"max drawdown", fmt.Sprintf("%.2f%%", r.MaxDrawdown*100)},
+		{"trades", strconv.Itoa(r.Trades)},
+		{"skipped", strconv.Itoa(r.Skipped)},
+		{"unfilled", strconv.Itoa(r.Unfilled)},
+		{"ledger", r.LedgerPath},
+	}
+}
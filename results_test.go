@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestRecordRun(t *testing.T) {
+	inTempDir(t)
+	start := day(t, "2019-01-02")
+	s := Strategy{Name: "twice", StartCash: 1000, Total: 1210, Start: start, Through: start.AddDate(2, 0, 0)}
+	s.Ledger = []Trade{{Date: start, Ticker: "AAA", Action: "BUY", Shares: 1, Price: 10}}
+	s.Equity = []float64{1100, 990, 1210}
+	r := newRun(s)
+	if !near(r.CAGR, s.growthRate()) || r.CAGR < 0.099 || r.CAGR > 0.101 {
+		t.Errorf("CAGR %g, want about 10%% a year", r.CAGR)
+	}
+	if !near(r.MaxDrawdown, 0.1) {
+		t.Errorf("MaxDrawdown %g, want 0.1", r.MaxDrawdown)
+	}
+	// the same strategy recorded twice in the same second
+	first, err := recordRun(r, s.Ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := recordRun(r, s.Ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID || first.LedgerPath == second.LedgerPath {
+		t.Errorf("both runs recorded as %s", first.ID)
+	}
+	runs, err := loadRuns()
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("loaded %d runs, %v", len(runs), err)
+	}
+	for _, want := range []Run{first, second} {
+		got, err := findRun(runs, want.ID)
+		if err != nil || got.LedgerPath != want.LedgerPath {
+			t.Errorf("findRun(%s) = %s, %v", want.ID, got.LedgerPath, err)
+		}
+	}
+}
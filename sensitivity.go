@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Sensitivity of a strategy to two of its parameters: every pair of values
+// on the grid is backtested over the same years, and the CAGR and max
+// drawdown of each are laid out as heatmaps. A good setting sits on a
+// plateau of neighbours that do about as well; one that beats all its
+// neighbours by a lot is more likely luck. The neighbours column is the
+// average CAGR of the cells around each one.
+
+var sensitivityFlags = []cli.Flag{
+	cli.StringFlag{Name: "strategy", Usage: "strategy to take the other parameters from (default the first)"},
+	cli.StringFlag{Name: "rows", Value: "threshold:0.04,0.045,0.049,0.05,0.055,0.06", Usage: "`PARAM:VALUES` down the grid"},
+	cli.StringFlag{Name: "cols", Value: "increment:2000,2500,3000,4000,5000", Usage: "`PARAM:VALUES` across the grid"},
+	cli.IntFlag{Name: "years", Usage: "years of history to backtest (default the strategy's)"},
+	cli.StringFlag{Name: "svg", Usage: "write the heatmaps to `FILE` as SVG"},
+	cli.StringFlag{Name: "png", Usage: "write the heatmaps to `FILE` as PNG, without labels"},
+	cli.StringFlag{Name: "csv", Usage: "write the grid to `FILE` as csv"},
+	formatFlag,
+}
+
+// gridParam is a Strategy parameter the grid can vary.
+type gridParam struct {
+	Pct bool
+	Set func(s *Strategy, v float64)
+}
+
+var gridParams = map[string]gridParam{
+	"threshold":      {true, func(s *Strategy, v float64) { s.ThresholdPct = v }},
+	"increment":      {false, func(s *Strategy, v float64) { s.Increment = v }},
+	"increment-pct":  {true, func(s *Strategy, v float64) { s.IncrementPct = v }},
+	"max-sector-pct": {true, func(s *Strategy, v float64) { s.MaxSectorPct = v }},
+	"limit-pct":      {true, func(s *Strategy, v float64) { s.LimitPct = v }},
+}
+
+type gridAxis struct {
+	Name   string
+	Param  gridParam
+	Values []float64
+}
+
+func parseAxis(spec string) (gridAxis, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	param, ok := gridParams[parts[0]]
+	if !ok || len(parts) < 2 {
+		names := []string{}
+		for name := range gridParams {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return gridAxis{}, fmt.Errorf("%q is not PARAM:VALUES with PARAM one of %s", spec, strings.Join(names, ", "))
+	}
+	values, err := parseNumbers(parts[1])
+	if err != nil {
+		return gridAxis{}, err
+	}
+	if len(values) == 0 {
+		return gridAxis{}, fmt.Errorf("no values for %s", parts[0])
+	}
+	return gridAxis{parts[0], param, values}, nil
+}
+
+func (a gridAxis) label(v float64) string {
+	if a.Param.Pct {
+		return fmt.Sprintf("%.4g%%", v*100)
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+// gridCell is the backtest of one pair of values.
+type gridCell struct {
+	Total, CAGR, Drawdown float64
+	Trades                int
+}
+
+func sensitivity(c *cli.Context) error {
+	format := c.String("format")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	base, err := findStrategy(c.String("strategy"))
+	if err != nil {
+		return err
+	}
+	rows, err := parseAxis(c.String("rows"))
+	if err != nil {
+		return fmt.Errorf("--rows: %v", err)
+	}
+	cols, err := parseAxis(c.String("cols"))
+	if err != nil {
+		return fmt.Errorf("--cols: %v", err)
+	}
+	if rows.Name == cols.Name {
+		return fmt.Errorf("the rows and columns both vary %s", rows.Name)
+	}
+	years := base.NumYears
+	if c.IsSet("years") {
+		years = c.Int("years")
+	}
+	if years <= 0 {
+		return fmt.Errorf("--years must be positive")
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	fmt.Fprintf(os.Stderr, "backtesting %d cells of %s over %d years\n", len(rows.Values)*len(cols.Values), base.Name, years)
+	grid, err := sweep(ctx, base, rows, cols, yearsAgo(years), time.Now(), float64(years))
+	if err != nil {
+		return err
+	}
+
+	records := []record{}
+	best := [2]int{}
+	for r, rv := range rows.Values {
+		for k, cv := range cols.Values {
+			cell := grid[r][k]
+			if cell.CAGR > grid[best[0]][best[1]].CAGR {
+				best = [2]int{r, k}
+			}
+			records = append(records, record{
+				{rows.Name, rv},
+				{cols.Name, cv},
+				{"total", math.Round(cell.Total*100) / 100},
+				{"cagr", optional(cell.CAGR)},
+				{"max_drawdown", optional(cell.Drawdown)},
+				{"trades", cell.Trades},
+				{"neighbours_cagr", optional(neighbours(grid, r, k))},
+			})
+		}
+	}
+	b := grid[best[0]][best[1]]
+	fmt.Fprintf(os.Stderr, "best: %s %s, %s %s at %.2f%%/yr, %.2f%% drawdown; its neighbours average %.2f%%/yr\n",
+		rows.Name, rows.label(rows.Values[best[0]]), cols.Name, cols.label(cols.Values[best[1]]),
+		b.CAGR*100, b.Drawdown*100, neighbours(grid, best[0], best[1])*100)
+
+	if file := c.String("csv"); file != "" {
+		if err := writeFile(file, func(w io.Writer) error { return writeRecords(w, "csv", records) }); err != nil {
+			return err
+		}
+	}
+	if file := c.String("svg"); file != "" {
+		if err := ioutil.WriteFile(file, []byte(heatmapSVG(base.Name, rows, cols, grid)), 0644); err != nil {
+			return err
+		}
+	}
+	if file := c.String("png"); file != "" {
+		if err := writeFile(file, func(w io.Writer) error { return png.Encode(w, heatmapPNG(grid)) }); err != nil {
+			return err
+		}
+	}
+	return printRecords(format, records)
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sweep backtests base with every pair of row and column values from start
+// up to end in one pass, valuing the accounts on the last session before
+// end and marking them to market every session for the drawdown.
+func sweep(ctx context.Context, base Strategy, rows, cols gridAxis, start, end time.Time, years float64) ([][]gridCell, error) {
+	runners := []*runner{}
+	for _, rv := range rows.Values {
+		for _, cv := range cols.Values {
+			s := base
+			rows.Param.Set(&s, rv)
+			cols.Param.Set(&s, cv)
+			runners = append(runners, newRunner(ctx, s, newAccount(s.StartCash), start, nil))
+		}
+	}
+	if err := pass(ctx, runners, start, end); err != nil {
+		return nil, err
+	}
+	grid := make([][]gridCell, len(rows.Values))
+	for r := range rows.Values {
+		grid[r] = make([]gridCell, len(cols.Values))
+		for k := range cols.Values {
+			run := runners[r*len(cols.Values)+k]
+			total, err := 0.0, run.Err
+			if err == nil {
+				total, err = equity(ctx, run.Account, PreviousSession(end))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s %s, %s %s: %v", rows.Name, rows.label(rows.Values[r]), cols.Name, cols.label(cols.Values[k]), err)
+			}
+			grid[r][k] = gridCell{
+				Total:    total,
+				CAGR:     cagr(base.StartCash, total, years),
+				Drawdown: maxDrawdown(append([]float64{base.StartCash}, run.Account.Equity...)),
+				Trades:   len(run.Account.Ledger),
+			}
+		}
+	}
+	return grid, nil
+}
+
+// neighbours is the average CAGR of the cells next to grid[r][k], diagonals
+// included.
+func neighbours(grid [][]gridCell, r, k int) float64 {
+	sum, n := 0.0, 0
+	for i := r - 1; i <= r+1; i++ {
+		for j := k - 1; j <= k+1; j++ {
+			if (i == r && j == k) || i < 0 || j < 0 || i >= len(grid) || j >= len(grid[i]) {
+				continue
+			}
+			sum += grid[i][j].CAGR
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
+
+// heatPanels are the maps drawn side by side: the value of each cell, and
+// whether more is better.
+var heatPanels = []struct {
+	Title  string
+	Value  func(gridCell) float64
+	Higher bool
+}{
+	{"CAGR", func(g gridCell) float64 { return g.CAGR }, true},
+	{"max drawdown", func(g gridCell) float64 { return g.Drawdown }, false},
+}
+
+// shade places v between the worst and best of the panel, -0.1 to 0.1, for
+// heatRGBA to colour the worst cell red and the best green.
+func shade(grid [][]gridCell, value func(gridCell) float64, higher bool, v float64) float64 {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, row := range grid {
+		for _, cell := range row {
+			lo, hi = math.Min(lo, value(cell)), math.Max(hi, value(cell))
+		}
+	}
+	if hi == lo {
+		return 0
+	}
+	t := (v - lo) / (hi - lo)
+	if !higher {
+		t = 1 - t
+	}
+	return (t - 0.5) / 5
+}
+
+func heatmapSVG(title string, rows, cols gridAxis, grid [][]gridCell) string {
+	const cellW, cellH, left, top, gap = 64.0, 28.0, 80.0, 64.0, 40.0
+	panelW := left + cellW*float64(len(cols.Values))
+	width, height := 2*panelW+gap, top+cellH*float64(len(rows.Values))+10
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %.0f %.0f" width="%.0f" xmlns="http://www.w3.org/2000/svg" font-size="11">`, width, height, width)
+	fmt.Fprintf(&b, `<text x="0" y="14" font-weight="bold">%s</text>`, html.EscapeString(title))
+	for p, panel := range heatPanels {
+		x0 := float64(p) * (panelW + gap)
+		fmt.Fprintf(&b, `<text x="%.0f" y="36">%s</text>`, x0+left, html.EscapeString(fmt.Sprintf("%s, %s down, %s across", panel.Title, rows.Name, cols.Name)))
+		for k, cv := range cols.Values {
+			fmt.Fprintf(&b, `<text x="%.0f" y="%.0f" text-anchor="middle">%s</text>`, x0+left+cellW*(float64(k)+0.5), top-8, html.EscapeString(cols.label(cv)))
+		}
+		for r, rv := range rows.Values {
+			y := top + cellH*float64(r)
+			fmt.Fprintf(&b, `<text x="%.0f" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`, x0+left-6, y+cellH/2, html.EscapeString(rows.label(rv)))
+			for k := range cols.Values {
+				x := x0 + left + cellW*float64(k)
+				v := panel.Value(grid[r][k])
+				fmt.Fprintf(&b, `<rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" fill="%s" stroke="#fff"/>`, x, y, cellW, cellH, heatColor(shade(grid, panel.Value, panel.Higher, v)))
+				fmt.Fprintf(&b, `<text x="%.0f" y="%.1f" text-anchor="middle" dominant-baseline="middle">%.1f%%</text>`, x+cellW/2, y+cellH/2, v*100)
+			}
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// heatmapPNG draws the panels of heatmapSVG as plain cells on white.
+func heatmapPNG(grid [][]gridCell) image.Image {
+	const cell, gap = 40, 40
+	cols := len(grid[0])
+	img := image.NewRGBA(image.Rect(0, 0, 2*cols*cell+gap, len(grid)*cell))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for p, panel := range heatPanels {
+		for r, row := range grid {
+			for k, g := range row {
+				rgb, alpha := heatRGBA(shade(grid, panel.Value, panel.Higher, panel.Value(g)))
+				blend := color.RGBA{A: 255}
+				for n, c := range []*uint8{&blend.R, &blend.G, &blend.B} {
+					*c = uint8(math.Round(255*(1-alpha) + float64(rgb[n])*alpha))
+				}
+				x0, y0 := p*(cols*cell+gap)+k*cell, r*cell
+				// leave a white line between cells
+				for y := y0; y < y0+cell-1; y++ {
+					for x := x0; x < x0+cell-1; x++ {
+						img.SetRGBA(x, y, blend)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
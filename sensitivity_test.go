@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNeighbours(t *testing.T) {
+	cagrs := func(rows ...[]float64) [][]gridCell {
+		grid := make([][]gridCell, len(rows))
+		for r, row := range rows {
+			for _, v := range row {
+				grid[r] = append(grid[r], gridCell{CAGR: v})
+			}
+		}
+		return grid
+	}
+	square := cagrs(
+		[]float64{1, 2, 3},
+		[]float64{4, 5, 6},
+		[]float64{7, 8, 9},
+	)
+	for _, c := range []struct {
+		name string
+		grid [][]gridCell
+		r, k int
+		want float64
+	}{
+		{"middle", square, 1, 1, 5},              // all eight around it
+		{"corner", square, 0, 0, 11.0 / 3},       // 2, 4 and 5
+		{"edge", square, 2, 1, 31.0 / 5},         // 4, 5, 6, 7 and 9
+		{"other corner", square, 2, 2, 19.0 / 3}, // 5, 6 and 8
+		{"one row", cagrs([]float64{1, 2, 4}), 0, 1, 2.5},
+		{"one column", cagrs([]float64{1}, []float64{3}), 1, 0, 1},
+		{"alone", cagrs([]float64{1}), 0, 0, math.NaN()},
+	} {
+		if got := neighbours(c.grid, c.r, c.k); !near(got, c.want) {
+			t.Errorf("%s: neighbours(%d, %d) = %g, want %g", c.name, c.r, c.k, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Signals run the rules of the strategies for a single day against an
+// account the user describes, and list the orders they would place after
+// the close, or the trades at the close for the "close" order type. The
+// account file is JSON with the cash and the shares held:
+//
+//	{"Cash": 25000, "Portfolio": {"AAPL": 10, "XYZ": 250}}
+
+var signalsFlags = []cli.Flag{
+	cli.StringFlag{Name: "date", Usage: "session to evaluate (default today)"},
+	cli.StringFlag{Name: "account", Usage: "JSON `FILE` with the cash and positions to size trades from"},
+	cli.Float64Flag{Name: "cash", Usage: "cash available, overriding the account file"},
+	cli.StringFlag{Name: "strategy", Usage: "only the named strategy (default all)"},
+	formatFlag,
+}
+
+func signals(c *cli.Context) error {
+	format := c.String("format")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	date := midnight(time.Now())
+	if c.String("date") != "" {
+		var err error
+		if date, err = parseDate(c.String("date")); err != nil {
+			return err
+		}
+	}
+	if !IsTradingDay(date) {
+		return fmt.Errorf("%s is not a trading day", dateKey(date))
+	}
+	state, err := accountState(c)
+	if err != nil {
+		return err
+	}
+	chosen := strategies
+	if c.String("strategy") != "" {
+		s, err := findStrategy(c.String("strategy"))
+		if err != nil {
+			return err
+		}
+		chosen = []Strategy{s}
+	}
+	if _, err := loadMetadata(); err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+
+	records := []record{}
+	for _, s := range chosen {
+		members, err := loadMembership(s.Index)
+		if err != nil {
+			return err
+		}
+		acct := state.clone()
+		for ticker := range acct.Portfolio {
+			q, ok, err := lastClose(ctx, ticker, date)
+			if err != nil {
+				return err
+			}
+			if ok {
+				acct.LastPrice[ticker] = q.Close
+			}
+		}
+		if err := tradeDay(ctx, s, acct, members, date, nil); err != nil {
+			return fmt.Errorf("%s: %v", s.Name, err)
+		}
+		if acct.Skipped > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %d reporters have no quote for %s", s.Name, acct.Skipped, dateKey(date))
+			if !sessionClosed(date) {
+				fmt.Fprint(os.Stderr, ", run again after the close")
+			}
+			fmt.Fprintln(os.Stderr)
+		}
+		for _, t := range acct.Ledger[len(state.Ledger):] {
+			// delistings are cashed out by the broker, not ordered
+			order := orderClose
+			if t.Action == "DELIST" {
+				order = "delisting"
+			}
+			records = append(records, record{
+				{"strategy", s.Name},
+				{"date", dateKey(t.Date)},
+				{"action", t.Action},
+				{"ticker", t.Ticker},
+				{"shares", t.Shares},
+				{"price", t.Price},
+				{"value", float64(t.Shares) * t.Price},
+				{"order", order},
+				{"limit", nil},
+			})
+		}
+		for _, o := range acct.Orders[len(state.Orders):] {
+			var limit interface{}
+			if o.Type == orderLimit {
+				limit = o.LimitPrice
+			}
+			records = append(records, record{
+				{"strategy", s.Name},
+				{"date", dateKey(o.Date)},
+				{"action", strings.ToUpper(o.Side)},
+				{"ticker", o.Ticker},
+				{"shares", o.Shares},
+				{"price", o.Price},
+				{"value", float64(o.Shares) * o.Price},
+				{"order", o.Type},
+				{"limit", limit},
+			})
+		}
+	}
+	if len(records) == 0 && format == "table" {
+		fmt.Printf("no trades for %s\n", dateKey(date))
+		return nil
+	}
+	return printRecords(format, records)
+}
+
+// accountState reads the account given with --account and --cash.
+func accountState(c *cli.Context) (*Account, error) {
+	if c.String("account") == "" && !c.IsSet("cash") {
+		return nil, fmt.Errorf("need --account or --cash to size the trades")
+	}
+	acct := newAccount(0)
+	if file := c.String("account"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, acct); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		portfolio := make(map[string]int)
+		for ticker, shares := range acct.Portfolio {
+			if shares > 0 {
+				portfolio[strings.ToUpper(ticker)] = shares
+			}
+		}
+		acct.Portfolio = portfolio
+		if acct.LastPrice == nil {
+			acct.LastPrice = make(map[string]float64)
+		}
+	}
+	if c.IsSet("cash") {
+		acct.Cash = c.Float64("cash")
+	}
+	return acct, nil
+}
+
+// clone copies a so it can be traded without changing the original.
+func (a *Account) clone() *Account {
+	b := *a
+	b.Portfolio = make(map[string]int)
+	for k, v := range a.Portfolio {
+		b.Portfolio[k] = v
+	}
+	b.LastPrice = make(map[string]float64)
+	for k, v := range a.LastPrice {
+		b.LastPrice[k] = v
+	}
+	b.Ledger = append([]Trade(nil), a.Ledger...)
+	b.Orders = append([]Order(nil), a.Orders...)
+	b.Equity = append([]float64(nil), a.Equity...)
+	return &b
+}
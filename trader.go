@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"io/ioutil"
@@ -8,23 +9,14 @@ import (
 	"math"
 	"net/http"
 	"os"
-	"regexp"
-	"runtime"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/piquette/finance-go/chart"
-	"github.com/piquette/finance-go/datetime"
 	"github.com/urfave/cli"
 )
 
-var russell2k = []string{
-	"FLWS", "FCCY", "SRCE", "XXII", "DDD", "EGHT", "AVHI", "ATEN", "AAC", "AAON", "AIR", "AAN", "ABAX", "ABEO", "ANF", "ABM", "AXAS", "ACIA", "ACTG", "ACAD", "AKR", "AXDX", "XLRN", "ANCX", "ACCO", "ARAY", "AKAO", "ACHN", "ACIW", "ACRS", "ACMR", "ACNB", "ACOR", "ATU", "GOLF", "ACXM", "ADMS", "AE", "ADUS", "IOTS", "ADMA", "ATGE", "ADTN", "ADRO", "ADSW", "WMS", "ADES", "AEIS", "ASIX", "ADVM", "AEGN", "AGLE", "AERI", "HIVE", "AJRD", "AVAV", "MITT", "AGEN", "AGYS", "ADC", "AGFS", "AIMT", "ATSG", "AYR", "AKS", "AKCA", "AKBA", "AKRX", "ALG", "ALRM", "AIN", "ALBO", "ALDR", "ALDX", "ALEX", "ALX", "ALCO", "ATI", "ABTX", "ALGT", "ALNA", "ALE", "AOI", "AMOT", "MDRX", "AOSL", "AMR", "ALTR", "AYX", "ASPS", "AIMC", "AMAG", "AMBC", "AMBA", "AMBR", "AMC", "AMED", "APEI", "AMRC", "AAT", "AXL", "AEO", "AEL", "AMNB", "AOBC", "ARII", "ARA", "ARL", "AMSWA", "AWR", "AVD", "AMWD", "CRMT", "COLD", "ABCB", "AMSF", "ATLO", "FOLD", "AMKR", "AMN", "AMRX", "AMPH", "AMPE", "AFSI", "AMRS", "ANAB", "ANDE", "ANGO", "ANIP", "ANIK", "AXE", "ATRS", "ANH", "APLS", "APOG", "ARI", "AMEH", "APPF", "AIT", "AAOI", "AREX", "PETX", "AVID", "CAR", "AVA", "AVX", "ACLS", "AXGN", "AAXN", "AXTI", "AZZ", "BGS", "RILY", "BW", "BMI", "BCPC", "BWINB", "BANC", "BANF", "BLX", "TBBK", "BXS", "BOCH", "BMRC", "NTB", "BPRN", "BFIN", "BWFG", "BANR", "BHB", "BNED", "BKS", "B", "BBSI", "BAS", "BSET", "BCML", "BBX", "BCBP", "BECN", "BBGI", "BZH", "BBBY", "BELFB", "BDC", "BLCM", "BEL", "BHE", "BNCL", "CDMO", "BGSF", "BGFV", "BIG", "A", "BH", "BCRX", "BHVN", "BIOS", "BSTC", "BEAT", "BTX", "BJRI", "BKH", "BLKB", "BL", "BXMT", "BLMN", "BCOR", "BLBD", "BHBK", "BXG", "BXC", "BPMC", "BRG", "BMCH", "BOFI", "WIFI", "BCC", "BOJA", "BCEI", "BOOT", "SAM", "BOMN", "BPFH", "EPAY", "BOX", "BYD", "BRC", "BHR", "BDGE", "BWB", "BGG", "BCOV", "BSIG", "EAT", "BCO", "BRS", "BNFT", "BHLB", "BRKS", "BRT", "BMTC", "BLMT", "BKE", "BLDR", "BFST", "BY", "CFFI", "CJ", "CCMP", "CACI", "WHD", "CADE", "CDZI", "CSTE", "CAI", "CALM", "CAMP", "CVGW", "CAL", "CRC", "CWT", "CALA", "CALX", "ELY", "CPE", "CLXT", "ABCD", "CBM", "CATC", "CAC", "CWH", "CNNE", "CPLA", "CCBG", "CSU", "CFFN", "CSTR", "CMO", "CARA", "CRR", "CBLK", "CARB", "CSII", "CDLX", "BKD", "BRKL", "CECO", "CTRE", "CARG", "CARO", "CRS", "CSV", "CRZO", "TAST", "CARS", "CVNA", "CASA", "CWST", "CASI", "CASS", "ROX", "CSLT", "CBIO", "CPRX", "CTT", "CATY", "CATO", "CVCO", "CBFV", "CBZ", "CBL", "CBTX", "CECE", "CDR", "CELC", "CBMG", "CELH", "CSFL", "CETV", "CENT", "CENTA", "CPF", "CVCY", "CENX", "CNBKA", "CNTY", "CCS", "CERS", "CEVA", "ECOM", "GTLS", "CHFN", "CATM", "CRCM", "CDNA", "CHEF", "CHGG", "CHFC", "CCXI", "CHMG", "CHMI", "CHSP", "CPK", "CHS", "PLCE", "CMRX", "CDXC", "CHDN", "CHUY", "CIEN", "CMPR", "CBB", "CIR", "CRUS", "CISN", "CTRN", "CZNC", "CIA", "CHCO", "CIO", "CIVB", "CIVI", "CLAR", "CLNE", "CCO", "CLFD", "CLSD", "CLW", "CLF", "CLPR", "CLD", "CLDR", "CLVS", "CCNE", "CNO", "COBZ", "COKE", "CDXS", "CVLY", "CDE", "CCF", "CLDT", "CAKE", "COHU", "COLL", "CLNC", "COLB", "CLBK", "CMCO", "FIX", "CMC", "CVGI", "CBU", "ESXB", "TCFC", "CYH", "CHCT", "CTBI", "CVLT", "CMP", "CPSI", "CIX", "CMTL", "CNCE", "CNMD", "CTWS", "CNOB", "CONN", "CEIX", "CNSL", "CTO", "CWCO", "CBPX", "CTRL", "CVON", "CVG", "CPS", "CTB", "CRBP", "CORT", "CORE", "CXW", "CORR", "CPLG", "CORI", "CSOD", "CRVL", "CRVS", "CCOI", "CWBR", "CNS", "CHRS", "CUZ", "CVA", "CVTI", "CVIA", "COWN", "CRAI", "CBRL", "BREW", "B", "CRAY", "CREE", "CROX", "CCRN", "CRY", "CYRX", "CSGS", "CSWI", "CTIC", "CTS", "CUB", "CUE", "CULP", "CURO", "CUBI", "CUTR", "CVBF", "CVI", "CBAY", "CYS", "CYTK", "CTMX", "CTSO", "DJCO", "DAKT", "DAN", "DAR", "DZSI", "DSKE", "PLAY", "DWSN", "DF", "DCPH", "DECK", "DFRG", "CMRE", "COTV", "ICBK", "COUP", "DENN", "DEPO", "DERM", "DHT", "DHIL", "DO", "DRH", "DRNA", "DBD", "DGII", "DMRC", "DDS", "DCOM", "DIN", "DIOD", "DPLO", "BOOM", "DGICA", "DFIN", "RRD", "LPG", "DORM", "PLOW", "DOVA", "DRQ", "DS", "DSW", "DCO", "DLTH", "DRRX", "DXPE", "DY", "DVAX", "DX", "EGBN", "EGLE", "EGRX", "ESTE", "DEA", "EML", "EGP", "KODK", "EBIX", "ECHO", "TACO", "DK", "DLX", "DNLI", "DNR", "EHTH", "EE", "LOCO", "ERI", "ESIO", "EFII", "ELVT", "ELF", "ELLI", "PERY", "ELOX", "EMCI", "EME", "EEX", "EBS", "NYNY", "EIG", "ENTA", "ECPG", "WIRE", "ENDP", "ECYT", "ELGX", "EIGI", "WATT", "UUUU", "ERII", "EGC", "ENS", "EGL", "EBF", "ENVA", "ENPH", "NPO", "ENSG", "ESGR", "ENFC", "ENTG", "ETM", "EBTC", "EFSC", "EVC", "ENV", "ECR", "EPC", "EDIT", "EDR", "EGAN", "ERA", "EROS", "ESCA", "ESE", "ESPR", "ESQ", "ESSA", "ESND", "ESNT", "ESL", "ETH", "ETSY", "EVBN", "EVLO", "EVBG", "EVRI", "EVTC", "EVH", "EOLS", "EPM", "AQUA", "XAN", "XELA", "EXLS", "EXPO", "EXPR", "EXTN", "EXTR", "EZPW", "FN", "FARM", "FMAO", "FFKT", "FMNB", "FPI", "FARO", "FATE", "FBK", "FFG", "FCB", "AGM", "FSS", "FII", "EVI", "ENZ", "EPE", "EPZM", "PLUS", "EQBK", "LION", "FRGI", "FNGN", "FISI", "FNSR", "FNLC", "FBNC", "FBP", "FBMS", "FRBA", "BUSE", "FBIZ", "FCBP", "FCBC", "FCCO", "FCF", "FBNK", "FDEF", "FFBC", "THFF", "FFIN", "FFNW", "FFWM", "FGBI", "FR", "INBK", "FIBK", "FLIC", "FRME", "FMBH", "FMBI", "FNWB", "FSFG", "FUNC", "FCFS", "FIT", "FIVE", "FPRX", "FIVN", "FBC", "FLXN", "FLXS", "FNHC", "FENC", "FOE", "FG", "FGEN", "FDBC", "FOR", "FORM", "FORR", "FRTA", "FBIO", "FET", "FWRD", "FOSL", "FSTR", "FBM", "FMI", "FCPT", "FOXF", "FRAN", "FC", "FELE", "FSB", "FSP", "FI", "RAIL", "FDP", "FRPT", "RESI", "FTR", "FRO", "FRPH", "FSBW", "FCN", "FTSI", "FCEL", "FULT", "FNKO", "FSNN", "FF", "GTHX", "GAIA", "GCAP", "GBL", "GME", "GCI", "GLOG", "GATX", "FTK", "FLNT", "FLDM", "FFIC", "FNBG", "FONR", "FSCT", "GEN", "GNMK", "GHDX", "THRM", "GNW", "GEO", "GABC", "GERN", "GTY", "ROCK", "GBCI", "GOOD", "LAND", "GLT", "GKOS", "GBT", "BRSS", "GBLI", "GMRE", "GNL", "GWRS", "GMED", "GLUU", "GLYC", "GMS", "GNC", "GOGO", "GLNG", "GORO", "GDEN", "GDP", "GSHD", "GPRO", "GRC", "GOV", "GPX", "GHM", "GPT", "GVA", "GPMT", "GTN", "GCP", "GNK", "GENC", "GNRC", "GFN", "GCO", "GIII", "GBX", "GCBC", "GHL", "GLRE", "GEF", "B", "GRIF", "GFF", "GPI", "GRPN", "GTT", "GTXI", "GBNK", "GNTY", "GES", "GLF", "GPOR", "HEES", "HABT", "HCKT", "HAE", "HK", "HNRG", "HALL", "HALO", "HYH", "HBB", "HLNE", "HWC", "HAFC", "HASI", "HONE", "HLIT", "HSC", "HBIO", "HVT", "HA", "HCOM", "HWKN", "HAYN", "FUL", "AJX", "GLDD", "GSBC", "GWB", "GNBC", "GRBK", "GDOT", "GPRE", "HTLF", "HL", "HSII", "HELE", "HSDT", "HLX", "HMTV", "HRI", "HTBK", "HCCI", "HFWA", "HRTG", "MLHR", "HRTX", "HT", "HTZ", "HSKA", "HF", "HIBB", "HPR", "HIL", "HI", "HTH", "HIFS", "HMSY", "HNI", "HBCP", "HOMB", "HMST", "HTBI", "FIXX", "HOFT", "HOPE", "HMN", "HBNC", "HZNP", "HDP", "TWNK", "HMHC", "HLI", "HCHC", "HCI", "HIIQ", "HR", "HCSG", "HQY", "HSTM", "HTLD", "IBKC", "ICFI", "ICHR", "IDA", "IDRA", "IESC", "IIVI", "ILG", "IMAX", "IMMR", "IMDZ", "IMGN", "IMMU", "IMH", "IMPV", "PI", "ICD", "IHC", "IRT", "IBCP", "INDB", "IBTX", "ILPT", "INFN", "IPCC", "III", "HIFR", "IEA", "NGVT", "IMKTA", "INWK", "IPHS", "IOSP", "IIPR", "INVA", "INGN", "INOV", "INO", "IPHI", "NSIT", "HOV", "HBMD", "HRG", "HUBG", "HUBS", "HUD", "HURC", "HURN", "HY", "NTLA", "I", "IPAR", "ICPT", "IDCC", "TILE", "INAP", "IBOC", "INSW", "ISCA", "XENT", "INTL", "ITCI", "IPI", "XON", "IIN", "IVC", "IVR", "ISTR", "ITG", "ISBC", "IRET", "ITIC", "NVTA", "IO", "IOVA", "IRMD", "IRTC", "IRDM", "IRBT", "IRWD", "ISRL", "STAR", "ITI", "ITRI", "JJSF", "JAX", "JCOM", "JACK", "INSM", "NSP", "INSP", "IBP", "IIIN", "INST", "INSY", "ITGR", "IDTI", "KAI", "KDMN", "KALU", "KALA", "KAMN", "KS", "KPTI", "KBH", "KBR", "FRAC", "KRNY", "KELYA", "KEM", "KMPR", "KMT", "KW", "KERX", "KEG", "KEYW", "KFRC", "KE", "KBAL", "KIN", "KND", "KINS", "KNSL", "KIRK", "KRG", "KREF", "KLDX", "KLXI", "KMG", "KNL", "KN", "KOPN", "KOP", "KFY", "KRA", "KTOS", "JAG", "JRVR", "JELD", "JCAP", "JILL", "JBT", "JOUT", "JNCE", "LRN", "KTWO", "LNDC", "LE", "LCI", "LNTH", "LPI", "LHO", "LSCC", "LAUR", "LAWS", "LCII", "LCNB", "LFGR", "LTXB", "LMAT", "LC", "TREE", "LEVL", "LXRX", "LXP", "LGIH", "LHCG", "BATRA", "BATRK", "LEXEA", "LILA", "LILAK", "LBRT", "LTRPA", "LPNT", "LCUT", "LGND", "LLEX", "LLNW", "LMNR", "LIND", "LNN", "LQDT", "LAD", "KRO", "KURA", "KVHI", "LJPC", "LZB", "LADR", "LTS", "LBAI", "LKFN", "LANC", "LITE", "LMNX", "LBC", "LDL", "MHO", "MCBC", "CLI", "MTSI", "MGNX", "SHOO", "MDGL", "MGLN", "MHLD", "MJCO", "MBUU", "MNK", "MLVF", "TUSK", "MNTX", "MTW", "MNKD", "MANT", "MMI", "MCS", "MPX", "HZO", "MRNS", "MRLN", "VAC", "MBII", "MRTN", "DOOR", "MTZ", "MTDR", "MTRN", "MTRX", "MATX", "MATW", "LIVN", "LOB", "LPSN", "LIVX", "LORL", "LPX", "LOXO", "LXU", "LKSD", "LTC", "LL", "MDCA", "MDC", "MRT", "MDCO", "MNOV", "MDSO", "MED", "MEDP", "MLNT", "MNLO", "MBWM", "MBIN", "MRCY", "MDP", "EBSB", "VIVO", "MMSI", "MTH", "MTOR", "MRSN", "MLAB", "CASH", "MEI", "MCB", "MGEE", "MTG", "MGPI", "MSTR", "MPB", "MBCN", "MSEX", "MSBI", "MSL", "MPO", "MOFG", "MCRN", "MLR", "MLP", "MAXR", "MMS", "MXL", "MXWL", "MBFI", "MBI", "MBTF", "MCFT", "MDR", "MGRC", "MC", "MTEM", "MNTA", "MCRI", "MGI", "MNR", "TYPE", "MNRO", "INNT", "A", "MPAA", "MOV", "MRC", "MSA", "MSGN", "MTGE", "MTSC", "MLI", "MWA", "LABL", "MUSA", "MBIO", "MFSF", "MVBF", "MYE", "MYOK", "MYRG", "MYGN", "NC", "NANO", "NSTG", "NH", "NK", "NSSC", "NTRA", "NATH", "NBHC", "MDXG", "MB", "MTX", "NERV", "MGEN", "MRTX", "MG", "MITK", "MINI", "MOBL", "MODN", "MOD", "NSM", "NGS", "NGVC", "NHTC", "NATR", "BABY", "NLS", "NCI", "NAVG", "NAV", "NBTB", "NCS", "NCSM", "NP", "NNI", "NEOG", "NEO", "NPTN", "NEOS", "NTGR", "NTCT", "NVRO", "NWHM", "NJR", "NEWM", "NEWR", "SNR", "NWY", "NYMT", "NYT", "NLNK", "NMRK", "NR", "NXEO", "NXRT", "NXST", "NKSH", "FIZZ", "NCMI", "NCOM", "NGHC", "NHI", "NHC", "NPK", "NRC", "NSA", "EYE", "NWLI", "NBN", "NOG", "NFBK", "NRIM", "NRE", "NWBI", "NWN", "NWPX", "NWE", "NWFL", "NOVT", "NVAX", "NVCR", "DNOW", "A", "NYLD", "NTRI", "NUVA", "NVTR", "NES", "NVEE", "NVEC", "NXTM", "NYMX", "OVLY", "OAS", "ORIG", "OII", "OCFC", "OCLR", "OFED", "OCUL", "OCN", "ODT", "ODP", "OFG", "NEXT", "NODK", "EGOV", "NCBS", "NIHD", "NINE", "NL", "LASR", "NMIH", "NNBR", "NE", "NDLS", "NAT", "OGS", "OLP", "OSPN", "OOMA", "OPBK", "OPK", "OPY", "OPTN", "OPB", "OSUR", "ORBC", "ORC", "ONVO", "OBNK", "ORN", "ORIT", "ORA", "ORRF", "OFIX", "KIDS", "OSIS", "OTTR", "OSG", "OSTK", "OVID", "OMI", "OXFD", "OXM", "PTSI", "CNXN", "PACB", "PMBC", "PPBI", "PCRX", "PTN", "OVBC", "ODC", "OIS", "OLBK", "ONB", "OSBC", "OLLI", "ZEUS", "OFLX", "OMER", "OMCL", "OMN", "ONDK", "PDCO", "PCTY", "PCSB", "PDCE", "PDFS", "PDLI", "PDLB", "PDVW", "BTU", "PGC", "PEB", "PENN", "PVAC", "JCP", "PWOD", "PEI", "PFSI", "PMT", "PEBO", "PEBK", "PFIS", "PUB", "PRFT", "PFGC", "PRSP", "PETQ", "PETS", "PFNX", "PFSW", "PGTI", "PHH", "PHIIK", "PAHC", "PLAB", "DOC", "P", "PHX", "PZZA", "PARR", "PAR", "PRTK", "PCYG", "PKE", "PRK", "PKOH", "PKBK", "PRTY", "PATK", "PEGI", "PNM", "COOL", "POL", "POR", "PTLA", "PBPB", "PCH", "POWL", "POWI", "PQG", "PRAA", "APTS", "PFBC", "PLPC", "PFBI", "PSDO", "PBH", "PRGX", "PSMT", "PRI", "PRMW", "PRIM", "PRA", "PFIE", "PGNX", "PRGS", "PUMP", "PRO", "PTI", "PRTA", "PRLB", "PRSC", "PVBC", "PFS", "PICO", "PDM", "PIR", "PIRS", "PNK", "PES", "PJC", "PBI", "PJT", "PLNT", "PLT", "AGS", "PLXS", "PLUG", "QSII", "QLYS", "NX", "QTNA", "QTRX", "QDEL", "QNST", "QES", "QHC", "QUOT", "RCM", "RARX", "RDN", "RLGT", "RDUS", "RDNT", "METC", "RMBS", "RPT", "RPD", "RAVN", "RYAM", "RBB", "ROLL", "RICK", "RMAX", "RDI", "RETA", "REPH", "RLH", "RRGB", "RRR", "RDFN", "RWT", "PBIP", "PSB", "PTCT", "PLSE", "PBYI", "PCYO", "PRPL", "PZN", "QTWO", "QADA", "QCRH", "QTS", "QUAD", "KWR", "QCP", "ROIC", "RTRX", "REVG", "RVNC", "REV", "REX", "REXR", "RXN", "RGCO", "RH", "RYTM", "RBBN", "RIGL", "RNET", "RMNI", "REI", "RAD", "RVSB", "RLI", "RLJ", "RMR", "RCKT", "RMTI", "RCKY", "ROG", "ROKU", "ROSE", "RST", "RDC", "RTIX", "RTEC", "RUSHA", "RUSHB", "RGNX", "RM", "RGS", "REIS", "RBNC", "MARK", "RNST", "REGI", "RCII", "RGEN", "RBCAA", "FRBK", "REN", "RECN", "TORC", "SASR", "JBSS", "SGMO", "SANM", "BFS", "SVRA", "SBBX", "SCSC", "SCHN", "SCHL", "SHLM", "SWM", "SAIC", "SGMS", "SALT", "STNG", "SCPH", "SSP", "SBCF", "CKH", "SMHI", "SHLD", "SPNE", "SEAS", "SCWX", "SLCT", "WTTR", "SIR", "SEM", "SELB", "SIGI", "SEMG", "SMTC", "RUTH", "RYI", "RHP", "STBA", "SBRA", "SB", "SFE", "SAFT", "SAFE", "SGA", "SAIA", "SAIL", "SBH", "SN", "SAFM", "SD", "SSTK", "SIFI", "SIEB", "SNNA", "SIEN", "BSRR", "SIGA", "SIGM", "SIG", "SLAB", "SBOW", "SAMG", "SFNC", "SMPL", "SSD", "SLP", "SBGI", "SITE", "SJW", "SKY", "SKYW", "SNBR", "SFS", "SGH", "SND", "SMBK", "SOI", "SLDB", "SAH", "SONC", "SRNE", "BID", "SEND", "SENEA", "SENS", "SXT", "MCRB", "SRG", "SREV", "SFBS", "SHAK", "SHEN", "SHLO", "SFL", "SCVL", "SHBI", "SSTI", "SFLY", "SR", "SAVE", "SMTA", "STXB", "SPOK", "SPWH", "SBPH", "SPSC", "SPXC", "FLOW", "SRCI", "JOE", "STAA", "STAG", "STMP", "SMP", "SXI", "STFC", "STBZ", "SCS", "STML", "SCL", "SBT", "STRL", "STC", "SF", "SYBT", "SRI", "SSYS", "STRS", "STRA", "RGR", "SJI", "SSB", "SFST", "SMBC", "SONA", "SBSI", "SWX", "SWN", "SP", "SPKE", "ONCE", "SPAR", "SPTN", "SPA", "SPPI", "TRK", "SPRO", "SLD", "SYKE", "SYNL", "SYNA", "SNDX", "SYNH", "SGYP", "SYBX", "SNX", "SYNT", "SYRS", "SYX", "TTOO", "TRHC", "TCMD", "TAHO", "TLRD", "TALO", "TNDM", "SKT", "TMHC", "TISI", "TECD", "TTGT", "TK", "TNK", "TGNA", "TRC", "TDOC", "TLRA", "TNAV", "SMMF", "INN", "SUM", "SNHY", "SXC", "SPWR", "RUN", "SHO", "SMCI", "SPN", "SGC", "SUP", "SUPN", "SVU", "SURF", "SGRY", "SRDX", "TBPH", "THR", "TPRE", "TDW", "TIER", "TTS", "TLYS", "TSBK", "TMST", "TIPT", "TWI", "TITN", "TVTY", "TIVO", "TOCA", "TMP", "TR", "BLD", "TOWR", "CLUB", "TOWN", "TRTX", "TPIC", "TCI", "TRXC", "TVPT", "TZOO", "TREC", "TG", "TREX", "TPH", "TLGT", "TELL", "THC", "TNC", "TEN", "TERP", "TRNO", "TBNK", "TTEK", "TTI", "TTPH", "TXRH", "TGH", "TGTX", "TCS", "MEET", "TTD", "TXMD", "TTMI", "TCX", "TUP", "TPB", "HEAR", "TPC", "TWIN", "TYME", "USCR", "USPH", "SLCA", "UFPT", "UCTT", "UPL", "RARE", "UMBF", "UMH", "UFI", "UNF", "UBSH", "UNB", "UIS", "UNT", "UBSI", "UCFC", "UCBI", "UBNK", "UFCS", "UIHC", "UNFI", "TCBK", "TRS", "TNET", "TPHS", "TSE", "GTS", "TSC", "TRTN", "TBK", "TGI", "TRNC", "TROX", "TBI", "TRUE", "TRUP", "TRST", "TRMK", "TTEC", "USAT", "USAK", "USNA", "UTMD", "VHI", "VLY", "VALU", "VNDA", "VREX", "VRNS", "VGR", "VEC", "VECO", "VRA", "VCYT", "VSTM", "VCEL", "PAY", "VRNT", "VBTX", "VRTV", "VERI", "VRS", "VVI", "VSAT", "VIAV", "VICR", "VRAY", "VKTX", "VLGEA", "UBFO", "USLM", "UTL", "UNTY", "UBX", "USAP", "UVV", "UEIC", "UFPI", "UHT", "UVE", "ULH", "UVSP", "UMRX", "UPLD", "UEC", "UE", "UBA", "ECOL", "WAFD", "WPG", "WRE", "WASH", "WSBF", "WTS", "WVE", "WDFC", "WEB", "WTW", "WMK", "WERN", "WSBC", "WAIR", "WTBA", "WABC", "WMC", "WNEB", "WHG", "WEYS", "WGL", "WSR", "WOW", "WRD", "WLDN", "WLH", "WLFC", "WSC", "WIN", "VHC", "VRTS", "VRTU", "VSH", "VPG", "VSTO", "VTL", "VSLR", "VCRA", "VG", "VYGR", "VSEC", "VUZI", "WTI", "WNC", "WDR", "WAGE", "WD", "HCC", "YELP", "YEXT", "YORW", "YRCW", "ZFGN", "ZAGG", "ZN", "ZIOP", "ZIXI", "ZOES", "ZGNX", "ZOM", "ZS", "ZUMZ", "WING", "WINA", "WGO", "WETF", "WMIH", "WWW", "WWD", "WK", "WRLD", "INT", "WWE", "WOR", "WMGI", "WSFS", "XCRA", "XNCR", "XHR", "XOXO", "XOMA", "XPER",
-}
-
-var sp500 = []string{
-	"AAPL", "MSFT", "AMZN", "FB", "JPM", "BRK.B", "GOOG", "GOOGL", "JNJ", "XOM", "BAC", "WFC", "V", "UNH", "PFE", "CVX", "T", "INTC", "HD", "VZ", "PG", "CSCO", "BA", "MA", "C", "KO", "MRK", "DIS", "PEP", "CMCSA", "DWDP", "NVDA", "NFLX", "ABBV", "ORCL", "PM", "AMGN", "WMT", "ADBE", "IBM", "MCD", "MDT", "MMM", "HON", "UNP", "ABT", "MO", "GE", "TXN", "ACN", "NKE", "GILD", "CRM", "BKNG", "UTX", "COST", "QCOM", "LLY", "BMY", "PYPL", "TMO", "SLB", "AVGO", "COP", "CAT", "GS", "USB", "UPS", "NEE", "LOW", "LMT", "AXP", "SBUX", "BIIB", "EOG", "PNC", "MS", "AMT", "BDX", "CVS", "ANTM", "CB", "MDLZ", "CSX", "CELG", "OXY", "DHR", "AGN", "TJX", "AET", "MU", "SCHW", "FDX", "ADP", "BLK", "ISRG", "CL", "WBA", "DUK", "RTN", "CHTR", "CME", "SPG", "ATVI", "BK", "GD", "SYK", "NOC", "PSX", "INTU", "SPGI", "AMAT", "SO", "VLO", "NSC", "ILMN", "FOXA", "AIG", "GM", "COF", "D", "MET", "DE", "CI", "CCI", "CTSH", "BSX", "PX", "EMR", "ZTS", "VRTX", "HUM", "TGT", "ESRX", "ITW", "MMC", "ICE", "PRU", "EXC", "KMB", "BBT", "EA", "HPQ", "F", "MAR", "ECL", "KHC", "MPC", "HAL", "SHW", "LYB", "ADI", "AFL", "BAX", "EQIX", "WM", "HCA", "PGR", "STZ", "ETN", "PLD", "TRV", "APD", "DAL", "APC", "AON", "AEP", "JCI", "FIS", "ALL", "KMI", "ROST", "STI", "SYY", "TEL", "PSA", "STT", "PXD", "FISV", "EBAY", "LRCX", "LUV", "VFC", "ROP", "SRE", "EW", "EL", "REGN", "ADSK", "TROW", "MCO", "APH", "ADM", "OKE", "GIS", "CNC", "PPG", "ALXN", "GLW", "ALGN", "YUM", "APTV", "PEG", "WMB", "ORLY", "DFS", "WY", "CXO", "MCK", "ZBH", "MTB", "RHT", "DLR", "DG", "FTV", "AVB", "DXC", "EQR", "ED", "HPE", "IR", "MNST", "KR", "XEL", "CCL", "WELL", "NTRS", "PH", "PCG", "PCAR", "DVN", "PAYX", "KEY", "MCHP", "ROK", "COL", "SWK", "CMI", "EIX", "NTAP", "HLT", "IP", "TWTR", "DLTR", "RF", "A", "CERN", "IDXX", "SYF", "WEC", "FCX", "VTR", "ANDV", "WDC", "NUE", "AMP", "PPL", "FITB", "DTE", "BXP", "WLTW", "FOX", "IQV", "CFG", "FLT", "ES", "MYL", "AZO", "MSI", "NEM", "INFO", "UAL", "HRS", "RCL", "GPN", "HIG", "BBY", "XLNX", "CLX", "CTL", "LH", "KLAC", "SBAC", "CBS", "TDG", "CTAS", "K", "GWW", "NOV", "TSN", "VRSK", "AME", "HES", "MRO", "APA", "SWKS", "HBAN", "SIVB", "TXT", "CMA", "RSG", "LLL", "O", "FAST", "EXPE", "FE", "HST", "ESS", "ETFC", "AAL", "AMD", "ABMD", "AWK", "STX", "CAH", "NBL", "WAT", "MSCI", "TSS", "EFX", "OMC", "AEE", "EVRG", "RMD", "VMC", "MTD", "ETR", "DHI", "PFG", "CBRE", "EMN", "ANSS", "CAG", "DGX", "BHGE", "MKC", "MGM", "VRSN", "LNC", "XL", "WRK", "GPC", "BLL", "CTXS", "LEN", "CHD", "BF.B", "HSY", "TTWO", "TIF", "EXPD", "XYL", "SNPS", "GGP", "DRI", "CA", "BR", "ULTA", "CMS", "ABC", "KMX", "CHRW", "FTI", "L", "ARE", "TPR", "AJG", "SJM", "MLM", "AKAM", "WYNN", "HSIC", "TAP", "CDNS", "DOV", "EQT", "IT", "COO", "MAS", "URI", "VNO", "HCP", "KSU", "KSS", "CNP", "SYMC", "HFC", "CPRT", "M", "MHK", "CMG", "FMC", "RJF", "EXR", "PVH", "HOLX", "MAA", "CF", "CINF", "HAS", "XRAY", "NWL", "UHS", "INCY", "ADS", "AAP", "FFIV", "QRVO", "ZION", "COG", "BEN", "NDAQ", "IFF", "MOS", "VAR", "JBHT", "HII", "UDR", "DRE", "PKG", "CBOE", "IVZ", "VIAB", "ALB", "LKQ", "NCLH", "DVA", "PRGO", "NRG", "IRM", "RHI", "HRL", "LNT", "AVY", "KORS", "TSCO", "SNA", "TMK", "SLG", "PKI", "REG", "FRT", "JNPR", "AES", "PNW", "XEC", "BWA", "NI", "ARNC", "RE", "NKTR", "WU", "IPG", "JEC", "AMG", "FBHS", "WHR", "AOS", "DISCK", "DISH", "UNM", "CPB", "FLIR", "FLR", "LB", "ALK", "ALLE", "PHM", "HOG", "NLSN", "RL", "JEF", "GRMN", "PNR", "SEE", "KIM", "AIV", "HBI", "GPS", "HP", "IPGP", "PBCT", "MAC", "COTY", "GT", "TRIP", "JWN", "FLS", "SCG", "AIZ", "LEG", "FL", "NWSA", "NFX", "MAT", "XRX", "EVHC", "SRCL", "BHF", "HRB", "PWR", "DISCA", "UAA", "UA", "NWS",
-}
-
 func main() {
 	app := cli.NewApp()
 	app.Name = "trader"
@@ -35,13 +27,107 @@ func main() {
 			Name:    "simulate",
 			Aliases: []string{"s"},
 			Usage:   "simulate the strategy",
-			Action:  simulate,
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "keep-going", Usage: "finish the other strategies when one fails, rather than stopping them there"},
+				cli.BoolFlag{Name: "resume", Usage: "carry on from the last checkpoint of each strategy"},
+				cli.StringFlag{Name: "report", Usage: "write an HTML report of the results to `FILE`"},
+				cli.StringFlag{Name: "benchmark", Value: "SPY", Usage: "ticker to compare the equity curves with in the report"},
+				cli.BoolFlag{Name: "strict", Usage: "fail on trades that rely on what wasn't known yet, see lookahead"},
+				formatFlag,
+			},
+			Action: simulate,
+		},
+		{
+			Name:   "lookahead",
+			Usage:  "report what in the strategies uses information from after their trades",
+			Flags:  lookaheadFlags,
+			Action: lookahead,
 		},
 		{
 			Name:    "earnings",
 			Aliases: []string{"e"},
 			Usage:   "check earnings releases",
+			Flags:   earningsFlags,
 			Action:  earnings,
+			Subcommands: []cli.Command{
+				{
+					Name:      "history",
+					Usage:     "list past earnings of a ticker and the reaction to them",
+					ArgsUsage: "TICKER",
+					Flags:     []cli.Flag{formatFlag},
+					Action:    earningsHistory,
+				},
+			},
+		},
+		{
+			Name:   "signals",
+			Usage:  "list the trades the strategies make today",
+			Flags:  signalsFlags,
+			Action: signals,
+		},
+		{
+			Name:   "trade",
+			Usage:  "place the day's orders of a strategy with a broker",
+			Flags:  tradeFlags,
+			Action: trade,
+		},
+		{
+			Name:   "mockbroker",
+			Usage:  "serve a local mock broker with the Alpaca API",
+			Flags:  mockbrokerFlags,
+			Action: mockbroker,
+		},
+		{
+			Name:  "warm",
+			Usage: "fill the earnings and quote caches for every trading day",
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "years", Value: 12, Usage: "years of history to fetch"},
+				cli.StringFlag{Name: "index", Value: "russell2k", Usage: "universe to fetch quotes for"},
+			},
+			Action: warm,
+		},
+		{
+			Name:   "migrate",
+			Usage:  "rekey old quote and earnings caches by exchange trading date and fetch the earnings days cached for russell2k only again",
+			Action: migrate,
+		},
+		{
+			Name:    "walkforward",
+			Aliases: []string{"w"},
+			Usage:   "validate strategy parameters out of sample",
+			Flags:   walkforwardFlags,
+			Action:  walkforward,
+		},
+		{
+			Name:    "montecarlo",
+			Aliases: []string{"m"},
+			Usage:   "simulate the spread of a strategy's results",
+			Flags:   montecarloFlags,
+			Action:  montecarlo,
+		},
+		{
+			Name:        "universe",
+			Aliases:     []string{"u"},
+			Usage:       "manage ticker universes",
+			Subcommands: universeCommands,
+		},
+		{
+			Name:        "analyze",
+			Aliases:     []string{"a"},
+			Usage:       "study the earnings reactions and the strategies",
+			Subcommands: analyzeCommands,
+		},
+		{
+			Name:        "paper",
+			Aliases:     []string{"p"},
+			Usage:       "forward-test strategies on paper",
+			Subcommands: paperCommands,
+		},
+		{
+			Name:        "results",
+			Aliases:     []string{"r"},
+			Usage:       "list, show, compare and delete past runs",
+			Subcommands: resultsCommands,
 		},
 	}
 
@@ -54,91 +140,121 @@ func main() {
 type Strategy struct {
 	Name         string
 	NumYears     int
-	Index        []string
+	Index        string
 	ThresholdPct float64
 	StartCash    float64
 	Increment    float64
 	IncrementPct float64
 	Total        float64
+
+	IncludeSectors []string
+	ExcludeSectors []string
+	MaxSectorPct   float64
+
+	EntryOrder string // see orders.go, default "open"
+	ExitOrder  string
+	LimitPct   float64
+	LimitDays  int
+
+	EntryInterval string // see intraday.go
+	EntryAfter    int
+	EntryUntil    int
+
+	Ledger    []Trade
+	Equity    []float64 // after every session, at the last prices seen
+	SectorPnL map[string]float64
+	Skipped   int
+	Unfilled  int
+	Partial   bool
+	Start     time.Time
+	Through   time.Time
+}
+
+type Trade struct {
+	Date   time.Time
+	Ticker string
+	Action string
+	Shares int
+	Price  float64
+}
+
+// Cash is the change in cash from the trade.
+func (t Trade) Cash() float64 {
+	if t.Action == "BUY" {
+		return -float64(t.Shares) * t.Price
+	}
+	return float64(t.Shares) * t.Price
 }
 
 var strategies = []Strategy{
 	{
 		Name:         "5yr, russell2k, 4% thresh, 2.5k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.04,
 		StartCash:    20000,
 		Increment:    2500,
-		Total:        39776.551768,
 	},
 	{
 		Name:         "5yr, russell2k, 5% thresh, 2k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.05,
 		StartCash:    20000,
 		Increment:    2000,
-		Total:        57211.928909,
 	},
 	{
 		Name:         "5yr, russell2k, 5% thresh, 2.5k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.05,
 		StartCash:    20000,
 		Increment:    2500,
-		Total:        54113.466045,
 	},
 	{
 		Name:         "5yr, russell2k, 5% thresh, 3k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.05,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        60977.663999,
 	},
 	{
 		Name:         "5yr, russell2k, 6% thresh, 2.5k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.06,
 		StartCash:    20000,
 		Increment:    2500,
-		Total:        27360.660436,
 	},
 	{
 		Name:         "5yr, russell2k, 4.5% thresh, 3k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.045,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        48166.254131,
 	},
 	{
 		Name:         "5yr, russell2k, 4.9% thresh, 3k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.049,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        60977.663999,
 	},
 	{
 		Name:         "8yr, russell2k, 4.9% thresh, 3k increment, 20k start",
 		NumYears:     8,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.049,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        62360.337167,
 	},
 	{
 		Name:         "5yr, russell2k, 4.9% thresh, 3k/33% increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.049,
 		StartCash:    20000,
 		Increment:    3000,
@@ -147,7 +263,7 @@ var strategies = []Strategy{
 	{
 		Name:         "8yr, russell2k, 4.9% thresh, 3k/33% increment, 20k start",
 		NumYears:     8,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.049,
 		StartCash:    20000,
 		Increment:    3000,
@@ -156,52 +272,47 @@ var strategies = []Strategy{
 	{
 		Name:         "5yr, russell2k, 5.5% thresh, 3k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.055,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        46528.630025,
 	},
 	{
 		Name:         "5yr, russell2k, 5% thresh, 4k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.05,
 		StartCash:    20000,
 		Increment:    4000,
-		Total:        35105.620685,
 	},
 	{
 		Name:         "5yr, russell2k, 5% thresh, 5k increment, 20k start",
 		NumYears:     5,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.05,
 		StartCash:    20000,
 		Increment:    5000,
-		Total:        28440.540269,
 	},
 	{
 		Name:         "12yr, russell2k, 5% thresh, 3k increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.05,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        612393.755073,
 	},
 	{
 		Name:         "12yr, russell2k, 4.9% thresh, 3k increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.049,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        652333.264589,
 	},
 	{
 		Name:         "12yr, russell2k, 4.9% thresh, 3k/33% increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.049,
 		StartCash:    20000,
 		Increment:    3000,
@@ -210,7 +321,7 @@ var strategies = []Strategy{
 	{
 		Name:         "12yr, russell2k, 4.9% thresh, 3k/25% increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.049,
 		StartCash:    20000,
 		Increment:    3000,
@@ -219,7 +330,7 @@ var strategies = []Strategy{
 	{
 		Name:         "12yr, russell2k, 4.9% thresh, 3k/50% increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.049,
 		StartCash:    20000,
 		Increment:    3000,
@@ -228,239 +339,611 @@ var strategies = []Strategy{
 	{
 		Name:         "12yr, russell2k, 5.1% thresh, 3k increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.051,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        582053.615363,
 	},
 	{
 		Name:         "12yr, russell2k, 4.8% thresh, 3k increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.048,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        599767.375191,
 	},
 	{
 		Name:         "12yr, russell2k, 4.7% thresh, 3k increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.047,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        623400.781010,
 	},
 	{
 		Name:         "12yr, russell2k, 4.75% thresh, 3k increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.0475,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        605935.095303,
 	},
 	{
 		Name:         "12yr, russell2k, 4.6% thresh, 3k increment, 20k start",
 		NumYears:     12,
-		Index:        russell2k,
+		Index:        "russell2k",
 		ThresholdPct: 0.046,
 		StartCash:    20000,
 		Increment:    3000,
-		Total:        565218.310733,
 	},
 }
 
-var doneStrats = make(chan Strategy)
+// findStrategy looks a strategy up by name, defaulting to the first one.
+func findStrategy(name string) (Strategy, error) {
+	if name == "" {
+		return strategies[0], nil
+	}
+	for _, s := range strategies {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return Strategy{}, fmt.Errorf("no strategy named %q", name)
+}
+
+type stratResult struct {
+	Strategy
+	Err      error
+	progress *progress
+}
 
 func simulate(c *cli.Context) error {
-	fmt.Println("simulating strategies:")
-	for _, s := range strategies {
-		go simulateStrat(s)
+	format := c.String("format")
+	if err := checkFormat(format); err != nil {
+		return err
 	}
-	for i := 0; i < len(strategies); i++ {
-		x := <-doneStrats
-		fmt.Printf("%s --> %f  (%f%)\n", x.Name, x.Total, (math.Pow((x.Total/x.StartCash), (1.0/float64(x.NumYears)))-1)*100)
+	// with json or csv, stdout only gets the records
+	info := os.Stdout
+	if format != "table" {
+		info = os.Stderr
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	if c.Bool("strict") {
+		ctx = withStrict(ctx)
+	}
+	board := newProgressBoard()
+	defer board.stop()
+	fmt.Fprintln(info, "simulating strategies:")
+	// without --keep-going a failure stops the other strategies where they
+	// are, leaving them partial
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	now := time.Now()
+	runners := make([]*runner, len(strategies))
+	rows := make([]*progress, len(strategies))
+	for k, s := range strategies {
+		rows[k] = board.add(s.Name)
+		runners[k] = startStrat(withProgress(runCtx, rows[k]), s, c.Bool("resume"), yearsAgo(s.NumYears), now)
+		if !c.Bool("keep-going") {
+			runners[k].stop = cancel
+		}
+	}
+	if err := simulateStrats(runCtx, runners, now); err != nil && runCtx.Err() == nil {
+		failAll(runners, err)
+	}
+	failed := []stratResult{}
+	results, runs := []Strategy{}, []Run{}
+	for k, r := range runners {
+		s, err := finishStrat(runCtx, r, now)
+		x := stratResult{s, err, rows[k]}
+		if x.Err != nil && !x.Partial {
+			board.finish(x.progress, "")
+			fmt.Fprintf(info, "%s --> FAILED\n", x.Name)
+			failed = append(failed, x)
+			continue
+		}
+		if format == "table" {
+			board.finish(x.progress, "%s", strategyReport(x.Strategy))
+		} else {
+			board.finish(x.progress, "")
+		}
+		r, err := recordRun(newRun(x.Strategy), x.Ledger)
+		if err != nil {
+			return fmt.Errorf("recording %s: %v", x.Name, err)
+		}
+		results, runs = append(results, x.Strategy), append(runs, r)
+	}
+	board.stop()
+	if format != "table" {
+		if err := printRecords(format, runRecords(runs)); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted, results are partial")
+	}
+	if file := c.String("report"); file != "" {
+		if err := writeReport(ctx, file, c.String("benchmark"), results, runs); err != nil {
+			return fmt.Errorf("report: %v", err)
+		}
+		fmt.Fprintf(info, "report written to %s\n", file)
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(info, "%d of %d strategies failed:\n", len(failed), len(strategies))
+		for _, x := range failed {
+			fmt.Fprintf(info, "  %s: %v\n", x.Name, x.Err)
+		}
+		return fmt.Errorf("%d strategies failed", len(failed))
 	}
 	return nil
 }
 
-func simulateStrat(s Strategy) {
-	if s.Total == 0 {
-		var now = time.Now()
-		var start = time.Date(now.Year()-s.NumYears, now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		day := time.Duration(time.Hour * 24)
-		amountHave := s.StartCash
-		portfolio := make(map[string]int)
-		for i := start; time.Now().Sub(i) > 0; i = i.Add(day) {
-			stocks := fetchEarnings(i, s.Index)
-			for _, stock := range stocks.Stocks {
-				closePrice, change := quoteForDate(stock, i)
-				if change < (-1 * s.ThresholdPct) { //buy low
-					if amountHave > s.Increment {
-						amountToBuy := int(math.Max(s.Increment/closePrice, (s.IncrementPct*amountHave)/closePrice))
-						amountHave -= (float64(amountToBuy) * closePrice)
-						portfolio[stock] += amountToBuy
-					}
+func strategyReport(x Strategy) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s --> %f  (%f%%)", x.Name, x.Total, x.growthRate()*100)
+	if x.Partial {
+		fmt.Fprintf(&b, "  partial, through %s", dateKey(x.Through))
+	}
+	fmt.Fprintln(&b)
+	if x.Skipped > 0 {
+		fmt.Fprintf(&b, "    %d signals skipped for missing quotes\n", x.Skipped)
+	}
+	if x.Unfilled > 0 {
+		fmt.Fprintf(&b, "    %d orders went unfilled\n", x.Unfilled)
+	}
+	b.WriteString(formatSectorPnL(x.SectorPnL))
+	return b.String()
+}
+
+// growthRate is the CAGR of s over the sessions it actually ran.
+func (s Strategy) growthRate() float64 {
+	return cagr(s.StartCash, s.Total, s.Through.Sub(s.Start).Hours()/24/365.25)
+}
+
+// cagr is the compound annual growth rate from start to end over years.
+func cagr(start, end, years float64) float64 {
+	return math.Pow(end/start, 1.0/years) - 1
+}
+
+// startStrat sets s up to be backtested from start up to end, picking up
+// from the last checkpoint if resume is set.
+func startStrat(ctx context.Context, s Strategy, resume bool, start, end time.Time) *runner {
+	r := newRunner(ctx, s, newAccount(s.StartCash), start, nil)
+	if resume {
+		cp, err := loadCheckpoint(s)
+		if err != nil {
+			r.fail(err)
+			return r
+		}
+		if cp != nil && !cp.Account.Through.IsZero() {
+			r.Start, r.Account = cp.Start, &cp.Account
+			r.From = SessionOffset(r.Account.Through, 1)
+		}
+	}
+	progressFrom(ctx).span(r.Start, end)
+	return r
+}
+
+// simulateStrats backtests the runners in one pass up to end, saving a
+// checkpoint of each every checkpointSessions sessions.
+func simulateStrats(ctx context.Context, runners []*runner, end time.Time) error {
+	from := end
+	for _, r := range runners {
+		if r.Err == nil && r.From.Before(from) {
+			from = r.From
+		}
+	}
+	for from.Before(end) {
+		to := SessionOffset(from, checkpointSessions)
+		if to.After(end) {
+			to = end
+		}
+		if err := pass(ctx, runners, from, to); err != nil {
+			return err
+		}
+		for _, r := range runners {
+			if r.Err == nil && r.From.Before(to) {
+				if err := saveCheckpoint(r.Strategy, r.Start, r.Account); err != nil {
+					r.fail(err)
 				}
-				if change > s.ThresholdPct { //sell high
-					if portfolio[stock] > 0 {
-						amountHave += float64(portfolio[stock]) * closePrice
-						portfolio[stock] = 0
+			}
+		}
+		from = to
+	}
+	return nil
+}
+
+// finishStrat values the account of r on the last session before end and
+// returns its strategy with the results. If ctx was cancelled the result so
+// far is returned along with the error, valued at the last prices seen and
+// marked Partial.
+func finishStrat(ctx context.Context, r *runner, end time.Time) (Strategy, error) {
+	s, acct := r.Strategy, r.Account
+	err := r.Err
+	if err == nil {
+		err = ctx.Err()
+	}
+	var values map[string]float64
+	if err == nil {
+		values, err = holdingValues(r.ctx, acct, PreviousSession(end))
+	}
+	if err != nil && (r.failed || ctx.Err() == nil) {
+		return s, err
+	}
+	s.Start, s.Through = r.Start, acct.Through
+	if err != nil {
+		s.Partial = true
+		values = acct.markToMarket()
+	}
+	s.Total = calculateTotal(acct.Cash, values)
+	s.Ledger = acct.Ledger
+	s.Equity = acct.Equity
+	s.Skipped = acct.Skipped
+	s.Unfilled = acct.Unfilled
+	s.SectorPnL = sectorPnL(s.Ledger, values)
+	return s, err
+}
+
+// Account is the cash and positions a strategy trades with.
+type Account struct {
+	Cash      float64
+	Portfolio map[string]int
+	LastPrice map[string]float64
+	Ledger    []Trade
+	Orders    []Order   // resting, waiting for a later bar
+	Skipped   int       // signals not evaluated for lack of a quote
+	Unfilled  int       // orders dropped without filling
+	Through   time.Time // last session traded
+	Equity    []float64 // value after every session traded
+}
+
+func newAccount(cash float64) *Account {
+	return &Account{
+		Cash:      cash,
+		Portfolio: make(map[string]int),
+		LastPrice: make(map[string]float64),
+	}
+}
+
+func (a *Account) apply(t Trade) {
+	a.Cash += t.Cash()
+	if t.Action == "BUY" {
+		a.Portfolio[t.Ticker] += t.Shares
+	} else {
+		a.Portfolio[t.Ticker] -= t.Shares
+	}
+	if a.Portfolio[t.Ticker] == 0 {
+		delete(a.Portfolio, t.Ticker)
+	}
+	a.Ledger = append(a.Ledger, t)
+}
+
+// value is the cash and the positions at the last price seen for each.
+func (a *Account) value() float64 {
+	return calculateTotal(a.Cash, a.markToMarket())
+}
+
+// markToMarket values the positions at the last price seen for each.
+func (a *Account) markToMarket() map[string]float64 {
+	values := make(map[string]float64)
+	for ticker, amount := range a.Portfolio {
+		values[ticker] = float64(amount) * a.LastPrice[ticker]
+	}
+	return values
+}
+
+// backtest trades s on every trading day from start up to end. A non-nil p
+// randomizes the entries.
+func backtest(ctx context.Context, s Strategy, acct *Account, start, end time.Time, p *perturbation) error {
+	r := newRunner(ctx, s, acct, start, p)
+	if err := pass(ctx, []*runner{r}, start, end); err != nil {
+		return err
+	}
+	return r.Err
+}
+
+// tradeDay applies the rules of s to the companies in members reporting on
+// the session i, placing orders in acct for later sessions, or trading at
+// the close for the "close" order type.
+func tradeDay(ctx context.Context, s Strategy, acct *Account, members *Membership, i time.Time, p *perturbation) error {
+	if err := s.checkOrders(); err != nil {
+		return err
+	}
+	delisted, err := sellDelisted(acct.Portfolio, acct.LastPrice, i)
+	if err != nil {
+		return err
+	}
+	for _, t := range delisted {
+		acct.apply(t)
+	}
+	stocks, err := fetchEarnings(ctx, i, members)
+	if err != nil {
+		return err
+	}
+	for _, stock := range stocks.Stocks {
+		q, ok, err := quoteForDate(ctx, stock, i)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			acct.Skipped++
+			continue
+		}
+		closePrice, change := q.Close, q.Change
+		acct.LastPrice[stock] = closePrice
+		if s.EntryInterval != "" {
+			if err := intradayBuy(ctx, s, acct, members, stock, i, p); err != nil {
+				return err
+			}
+		} else if change < (-1 * s.ThresholdPct) { //buy low
+			// an order can't fill before the signal, so it is only delayed
+			shift, drop := p.entryShift(s.entryOrder() == orderClose)
+			buyDate, buyPrice := i, closePrice
+			if s.entryOrder() != orderClose {
+				if shift > 0 {
+					buyDate = SessionOffset(i, shift)
+				}
+			} else if shift != 0 && !drop {
+				buyDate = SessionOffset(i, shift)
+				shifted, ok, err := quoteForDate(ctx, stock, buyDate)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					acct.Skipped++
+					drop = true
+				}
+				buyPrice = shifted.Close
+			}
+			if !drop {
+				amountToBuy := buyShares(s, acct, stock, buyPrice)
+				if amountToBuy > 0 {
+					at := tradeTime(s.entryOrder(), buyDate)
+					if err := checkLookahead(ctx, s, members, i, SessionClose(i), at, "buys "+stock); err != nil {
+						return err
 					}
 				}
+				if amountToBuy > 0 && s.entryOrder() == orderClose {
+					acct.apply(Trade{Date: buyDate, Ticker: stock, Action: "BUY", Shares: amountToBuy, Price: buyPrice})
+				} else if amountToBuy > 0 {
+					acct.Orders = append(acct.Orders, s.order("buy", stock, amountToBuy, buyPrice, buyDate))
+				}
+			}
+		}
+		if change > s.ThresholdPct { //sell high
+			if acct.Portfolio[stock] > 0 {
+				if err := checkLookahead(ctx, s, members, i, SessionClose(i), tradeTime(s.exitOrder(), i), "sells "+stock); err != nil {
+					return err
+				}
+			}
+			if acct.Portfolio[stock] > 0 && s.exitOrder() == orderClose {
+				acct.apply(Trade{Date: i, Ticker: stock, Action: "SELL", Shares: acct.Portfolio[stock], Price: closePrice})
+			} else if acct.Portfolio[stock] > 0 && !acct.resting(stock, "sell") {
+				acct.Orders = append(acct.Orders, s.order("sell", stock, acct.Portfolio[stock], closePrice, i))
 			}
 		}
-		s.Total = calculateTotal(amountHave, portfolio)
 	}
-	doneStrats <- s
+	return nil
 }
 
-func calculateTotal(cash float64, portfolio map[string]int) float64 {
-	day := time.Duration(time.Hour * 24)
-	yesterday := time.Now().Add(-1 * day)
+// buyShares sizes a buy of ticker at price from the cash not already
+// committed to resting orders.
+func buyShares(s Strategy, acct *Account, ticker string, price float64) int {
+	cash := acct.Cash - acct.committed()
+	if cash <= s.Increment || !sectorAllowed(s, ticker) {
+		return 0
+	}
+	amount := math.Max(s.Increment, s.IncrementPct*cash)
+	amount = math.Min(amount, sectorRoom(s, ticker, acct))
+	return int(amount / price)
+}
+
+// sellDelisted cashes out positions in tickers that stopped trading, at the
+// delisting price if known and otherwise at the last close we traded on.
+func sellDelisted(portfolio map[string]int, lastPrice map[string]float64, date time.Time) ([]Trade, error) {
+	trades := []Trade{}
 	for ticker, amount := range portfolio {
-		closePrice, _ := quoteForDate(ticker, yesterday)
-		cash += (float64(amount) * closePrice)
+		d, ok, err := Delisted(ticker, date)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		price := d.Price
+		if price == 0 {
+			price = lastPrice[ticker]
+		}
+		trades = append(trades, Trade{Date: date, Ticker: ticker, Action: "DELIST", Shares: amount, Price: price})
 	}
-	return cash
+	return trades, nil
 }
 
-type Quotes struct {
-	Ticker      string
-	ClosePrices map[time.Time]float64
-	Changes     map[time.Time]float64
+// holdingValues values each position at the last close on or before date,
+// or at the last price traded at if there is none.
+func holdingValues(ctx context.Context, acct *Account, date time.Time) (map[string]float64, error) {
+	values := make(map[string]float64)
+	for ticker, amount := range acct.Portfolio {
+		closePrice := acct.LastPrice[ticker]
+		q, ok, err := lastClose(ctx, ticker, date)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			closePrice = q.Close
+		}
+		values[ticker] = float64(amount) * closePrice
+	}
+	return values, nil
 }
 
-func quoteForDate(ticker string, date time.Time) (closePrice float64, change float64) {
-	file := fmt.Sprintf("quotes/%s", ticker)
-	var result = new(Quotes)
-	if _, err := os.Stat(file); err == nil {
-		// file exists, check it
-		err = Load(file, result)
-		Check(err, file)
-		if closePrice, ok := result.ClosePrices[date]; ok {
-			if change, ok := result.Changes[date]; ok {
-				return closePrice, change
+func calculateTotal(cash float64, values map[string]float64) float64 {
+	for _, value := range values {
+		cash += value
+	}
+	return cash
+}
+
+func warm(c *cli.Context) error {
+	members, err := loadMembership(c.String("index"))
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	now := time.Now()
+	start := yearsAgo(c.Int("years"))
+	for _, session := range Sessions(start, now) {
+		stocks, err := fetchEarnings(ctx, session, members)
+		if err != nil {
+			return err
+		}
+		for _, stock := range stocks.Stocks {
+			if _, _, err := quoteForDate(ctx, stock, session); err != nil {
+				return err
 			}
 		}
+		fmt.Printf("%s: %d reporting\n", session.Format(dateLayout), len(stocks.Stocks))
 	}
-	if result.Changes == nil {
-		result.Changes = make(map[time.Time]float64)
-	}
-	if result.ClosePrices == nil {
-		result.ClosePrices = make(map[time.Time]float64)
-	}
-
-	day := time.Duration(time.Hour * 24)
-	enddate := date.Add(day)
-	start := datetime.New(&date)
-	end := datetime.New(&enddate)
-	params := &chart.Params{
-		Symbol:   ticker,
-		Interval: datetime.OneDay,
-		Start:    start,
-		End:      end,
-	}
-	iter := chart.Get(params)
-	for iter.Next() {
-		b := iter.Bar()
-		diff := b.Close.Sub(b.Open)
-		if b.Open.Sign() == 0 {
-			return 0.0, 0.0
-		}
-		chg := diff.Div(b.Open)
-		change, _ := chg.Float64()
-		closePrice, _ := b.Close.Float64()
-		result.Ticker = ticker
-		result.Changes[date] = change
-		result.ClosePrices[date] = closePrice
-		err := Save(file, result)
-		Check(err, file)
-		return closePrice, change
-	}
-	return 0.0, 0.0
-}
-
-func earnings(c *cli.Context) error {
-	stocks := fetchEarnings(time.Now(), sp500)
-	fmt.Print(stocks.Stocks)
 	return nil
 }
 
 type EarningDate struct {
-	Date   time.Time
-	Stocks []string
+	Date    time.Time
+	Stocks  []string
+	Events  map[string]EarningEvent
+	Version int
 }
 
-func fetchEarnings(date time.Time, index []string) EarningDate {
-	url := fmt.Sprintf("https://www.bloomberg.com/markets/api/calendar/earnings/US?locale=en&date=%s", date.Format("2006-01-02"))
-	file := fmt.Sprintf("earningdate/%s", date.Format("2006-01-02"))
+// earningsVersion is the version of the earningdate/ cache. Days cached
+// before version 1 only list the russell2k companies on the calendar. They
+// are used as they are until migrate fetches them again.
+const earningsVersion = 1
+
+var staleEarnings sync.Once
+
+// warnStaleEarnings warns that n of the cached days read predate
+// earningsVersion.
+func warnStaleEarnings(n int) {
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d cached earnings days only list russell2k companies, run migrate to fetch them again\n", n)
+	}
+}
 
+func earningsFile(date time.Time) string {
+	return fmt.Sprintf("earningdate/%s", dateKey(date))
+}
+
+// fetchEarnings returns the members of the index reporting on date, or every
+// company reporting if members is nil. The cache keeps every ticker on the
+// calendar so it can be filtered against the membership as of any day, for
+// any index.
+func fetchEarnings(ctx context.Context, date time.Time, members *Membership) (EarningDate, error) {
+	date = midnight(date)
+	if d := sessionFrom(ctx); d != nil && dateKey(d.Date) == dateKey(date) {
+		countCache(ctx, true)
+		result := d.Earnings
+		result.Stocks = filterEarnings(result.Stocks, members, date)
+		return result, nil
+	}
+	file := earningsFile(date)
+	defer lockFile(file)()
 	var result = new(EarningDate)
 	if _, err := os.Stat(file); err == nil {
 		// file exists
-		err = Load(file, result)
-		Check(err, file)
-		return *result
+		if err := Load(file, result); err != nil {
+			return EarningDate{}, fmt.Errorf("%s: %v", file, err)
+		}
+		if result.Version < earningsVersion {
+			staleEarnings.Do(func() {
+				fmt.Fprintln(os.Stderr, "warning: some cached earnings days only list russell2k companies, run migrate to fetch them again")
+			})
+		}
+		countCache(ctx, true)
+		result.Stocks = filterEarnings(result.Stocks, members, date)
+		return *result, nil
 	}
+	countCache(ctx, false)
+	result, err := downloadEarnings(ctx, date)
+	if err != nil {
+		return EarningDate{}, err
+	}
+	result.Stocks = filterEarnings(result.Stocks, members, date)
+	return *result, nil
+}
+
+// downloadEarnings fetches the whole calendar of date and caches it unless
+// it is still to come.
+func downloadEarnings(ctx context.Context, date time.Time) (*EarningDate, error) {
+	url := fmt.Sprintf("https://www.bloomberg.com/markets/api/calendar/earnings/US?locale=en&date=%s", dateKey(date))
 	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/66.0.3359.181 Safari/537.36")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("fetching earnings for %s: %v", dateKey(date), err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching earnings for %s: %s", dateKey(date), resp.Status)
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("fetching earnings for %s: %v", dateKey(date), err)
+	}
+	result := &EarningDate{Date: date, Version: earningsVersion}
+	result.Stocks, result.Events = parseEarnings(string(body))
+	// the calendar of days to come still changes
+	if !date.After(midnight(time.Now())) {
+		if err := Save(earningsFile(date), result); err != nil {
+			return nil, fmt.Errorf("%s: %v", earningsFile(date), err)
+		}
 	}
-	stocks := filterEarnings(string(body), index)
-	result.Date = date
-	result.Stocks = stocks
-	err = Save(file, result)
-	Check(err, file)
-	return *result
+	return result, nil
 }
 
-func filterEarnings(body string, index []string) []string {
-	re := regexp.MustCompile(`/companies/security/(\w{1,4}):US`)
-	matches := re.FindAllStringSubmatch(body, -1)
+// filterEarnings keeps the tickers that were index members on date, or all
+// of them without members.
+func filterEarnings(tickers []string, members *Membership, date time.Time) []string {
+	if members == nil {
+		return tickers
+	}
 	winners := []string{}
-	for _, match := range matches {
-		ticker := match[1]
-		if isInArray(ticker, index) {
+	for _, ticker := range tickers {
+		if members.IsMember(ticker, date) {
 			winners = append(winners, ticker)
 		}
 	}
 	return winners
 }
 
-func isInArray(s string, list []string) bool {
-	for _, str := range list {
-		if s == str {
-			return true
-		}
-	}
-	return false
-}
-
-// Encode via Gob to file
+// Encode via Gob to file. The file is written next to path and renamed over
+// it, so a reader never sees it half written.
 func Save(path string, object interface{}) error {
-	file, err := os.Create(path)
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	err = file.Chmod(0644)
 	if err == nil {
-		encoder := gob.NewEncoder(file)
-		encoder.Encode(object)
+		err = gob.NewEncoder(file).Encode(object)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
 	}
-	file.Close()
 	return err
 }
 
@@ -474,11 +957,3 @@ func Load(path string, object interface{}) error {
 	file.Close()
 	return err
 }
-
-func Check(e error, f string) {
-	if e != nil {
-		_, file, line, _ := runtime.Caller(1)
-		fmt.Println(line, "\t", file, "\n", f, "\n", e)
-		os.Exit(1)
-	}
-}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Ticker universes are versioned text files under universes/<name>/, one file
+// per snapshot named by the date it took effect (universes/sp500/2018-06-01.txt).
+// Each line is a ticker or an operation on another universe:
+//
+//	include russell2k
+//	exclude financials
+//	intersect sp500@2018-06-01
+//
+// Universes that are included make up the members together with the listed
+// tickers, which are then narrowed down by every exclude and intersect. A
+// reference may pin a date with name@YYYY-MM-DD, otherwise it is resolved as
+// of the same date as the universe referencing it. sector:NAME refers to every
+// ticker in that sector of the ticker metadata, so "sp500 minus financials" is
+//
+//	include sp500
+//	exclude sector:Financial Services
+
+const (
+	universeDir  = "universes"
+	sectorPrefix = "sector:"
+)
+
+type universeOp struct {
+	Kind string
+	Ref  string
+}
+
+type snapshot struct {
+	Version time.Time
+	Tickers map[string]bool
+	Ops     []universeOp
+}
+
+type universe struct {
+	Name      string
+	Snapshots []snapshot
+}
+
+var universes = make(map[string]*universe)
+
+var universeCommands = []cli.Command{
+	{
+		Name:   "list",
+		Usage:  "list universes and their versions",
+		Action: universeList,
+	},
+	{
+		Name:      "show",
+		Usage:     "print the members of a universe",
+		ArgsUsage: "NAME[@DATE]",
+		Action:    universeShow,
+	},
+	{
+		Name:      "diff",
+		Usage:     "compare two universes or two dates of one universe",
+		ArgsUsage: "NAME[@DATE] NAME[@DATE]",
+		Action:    universeDiff,
+	},
+	{
+		Name:      "import",
+		Usage:     "import a universe snapshot from a csv file",
+		ArgsUsage: "NAME FILE",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "date", Usage: "date the snapshot takes effect (default today)"},
+			cli.StringFlag{Name: "column", Usage: "csv column holding the tickers (default ticker or symbol)"},
+		},
+		Action: universeImport,
+	},
+	{
+		Name:      "union",
+		Usage:     "define a universe as the union of others",
+		ArgsUsage: "NAME UNIVERSE...",
+		Flags:     []cli.Flag{cli.StringFlag{Name: "date", Usage: "date the definition takes effect (default today)"}},
+		Action:    universeCombine("include", "include"),
+	},
+	{
+		Name:      "intersect",
+		Usage:     "define a universe as the intersection of others",
+		ArgsUsage: "NAME UNIVERSE...",
+		Flags:     []cli.Flag{cli.StringFlag{Name: "date", Usage: "date the definition takes effect (default today)"}},
+		Action:    universeCombine("include", "intersect"),
+	},
+	{
+		Name:      "subtract",
+		Usage:     "define a universe as the first one minus the others",
+		ArgsUsage: "NAME UNIVERSE...",
+		Flags:     []cli.Flag{cli.StringFlag{Name: "date", Usage: "date the definition takes effect (default today)"}},
+		Action:    universeCombine("include", "exclude"),
+	},
+}
+
+// loadUniverseClosure loads name and everything it references. Callers hold
+// membershipMu.
+func loadUniverseClosure(name string, visiting map[string]bool) error {
+	name, _ = splitRef(name)
+	if strings.HasPrefix(name, sectorPrefix) {
+		_, err := loadMetadata()
+		return err
+	}
+	if visiting[name] {
+		return fmt.Errorf("universe %s references itself", name)
+	}
+	ok, err := loadHistory(name)
+	if err != nil {
+		return err
+	}
+	if _, loaded := universes[name]; loaded {
+		return nil
+	}
+	u, err := readUniverse(name)
+	if os.IsNotExist(err) && ok {
+		return nil
+	}
+	if os.IsNotExist(err) {
+		return fmt.Errorf("unknown universe %q", name)
+	}
+	if err != nil {
+		return err
+	}
+	visiting[name] = true
+	for _, s := range u.Snapshots {
+		for _, op := range s.Ops {
+			if err := loadUniverseClosure(op.Ref, visiting); err != nil {
+				return err
+			}
+		}
+	}
+	delete(visiting, name)
+	universes[name] = u
+	return nil
+}
+
+func readUniverse(name string) (*universe, error) {
+	dir := filepath.Join(universeDir, name)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	u := &universe{Name: name}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".txt") {
+			continue
+		}
+		version, err := time.ParseInLocation(dateLayout, strings.TrimSuffix(f.Name(), ".txt"), exchangeTZ)
+		if err != nil {
+			return nil, fmt.Errorf("%s: version must be a date: %v", filepath.Join(dir, f.Name()), err)
+		}
+		s, err := readSnapshot(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s.Version = version
+		u.Snapshots = append(u.Snapshots, s)
+	}
+	if len(u.Snapshots) == 0 {
+		return nil, fmt.Errorf("%s: no snapshots", dir)
+	}
+	sort.Slice(u.Snapshots, func(i, j int) bool {
+		return u.Snapshots[i].Version.Before(u.Snapshots[j].Version)
+	})
+	return u, nil
+}
+
+func readSnapshot(path string) (snapshot, error) {
+	s := snapshot{Tickers: make(map[string]bool)}
+	file, err := os.Open(path)
+	if err != nil {
+		return s, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case len(fields) == 1:
+			s.Tickers[fields[0]] = true
+		case fields[0] == "include" || fields[0] == "exclude" || fields[0] == "intersect":
+			ref := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+			s.Ops = append(s.Ops, universeOp{Kind: fields[0], Ref: ref})
+		default:
+			return s, fmt.Errorf("%s:%d: cannot parse %q", path, n, line)
+		}
+	}
+	return s, scanner.Err()
+}
+
+// at returns the snapshot in effect on date. Dates before the first snapshot
+// get the first one; a zero date gets the latest.
+func (u *universe) at(date time.Time) *snapshot {
+	if date.IsZero() {
+		return &u.Snapshots[len(u.Snapshots)-1]
+	}
+	s := &u.Snapshots[0]
+	for i := range u.Snapshots {
+		if u.Snapshots[i].Version.After(date) {
+			break
+		}
+		s = &u.Snapshots[i]
+	}
+	return s
+}
+
+// splitRef splits name@2006-01-02 into the name and its pinned date.
+func splitRef(ref string) (string, time.Time) {
+	i := strings.Index(ref, "@")
+	if i < 0 {
+		return ref, time.Time{}
+	}
+	date, err := time.ParseInLocation(dateLayout, ref[i+1:], exchangeTZ)
+	if err != nil {
+		return ref, time.Time{}
+	}
+	return ref[:i], date
+}
+
+// contains evaluates membership of a single ticker. Callers hold membershipMu.
+func contains(ref, ticker string, date time.Time) bool {
+	name, pinned := splitRef(ref)
+	if !pinned.IsZero() {
+		date = pinned
+	}
+	if strings.HasPrefix(name, sectorPrefix) {
+		return strings.EqualFold(tickerInfo(ticker).Sector, strings.TrimPrefix(name, sectorPrefix))
+	}
+	if spans, ok := histories[name]; ok {
+		return spansContain(spans[ticker], date)
+	}
+	u, ok := universes[name]
+	if !ok {
+		return false
+	}
+	s := u.at(date)
+	in := s.Tickers[ticker]
+	for _, op := range s.Ops {
+		if !in && op.Kind == "include" {
+			in = contains(op.Ref, ticker, date)
+		}
+	}
+	for _, op := range s.Ops {
+		if !in {
+			break
+		}
+		switch op.Kind {
+		case "exclude":
+			in = !contains(op.Ref, ticker, date)
+		case "intersect":
+			in = contains(op.Ref, ticker, date)
+		}
+	}
+	return in
+}
+
+// collectCandidates gathers every ticker that could be a member of ref.
+func collectCandidates(ref string, into map[string]bool, seen map[string]bool) {
+	name, _ := splitRef(ref)
+	if seen[name] {
+		return
+	}
+	seen[name] = true
+	if strings.HasPrefix(name, sectorPrefix) {
+		for ticker := range metadata {
+			if contains(name, ticker, time.Time{}) {
+				into[ticker] = true
+			}
+		}
+		return
+	}
+	for ticker := range histories[name] {
+		into[ticker] = true
+	}
+	if u, ok := universes[name]; ok {
+		for _, s := range u.Snapshots {
+			for ticker := range s.Tickers {
+				into[ticker] = true
+			}
+			for _, op := range s.Ops {
+				if op.Kind == "include" {
+					collectCandidates(op.Ref, into, seen)
+				}
+			}
+		}
+	}
+}
+
+func pointInTime(ref string) bool {
+	name, _ := splitRef(ref)
+	if _, ok := histories[name]; ok || strings.HasPrefix(name, sectorPrefix) {
+		return true
+	}
+	u, ok := universes[name]
+	if !ok {
+		return false
+	}
+	for _, s := range u.Snapshots {
+		if len(s.Tickers) > 0 {
+			return false
+		}
+		for _, op := range s.Ops {
+			if !pointInTime(op.Ref) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// publishedAt is when the data contains reads for ref on date became known:
+// the version of the latest snapshot listing tickers that it uses, or when
+// the ticker metadata was written for sectors. Constituents histories and
+// snapshots made only of operations are known all along.
+func publishedAt(ref string, date time.Time) time.Time {
+	name, pinned := splitRef(ref)
+	if !pinned.IsZero() {
+		date = pinned
+	}
+	if strings.HasPrefix(name, sectorPrefix) {
+		return metadataAsOf
+	}
+	u, ok := universes[name]
+	if _, history := histories[name]; history || !ok {
+		return time.Time{}
+	}
+	s := u.at(date)
+	var latest time.Time
+	if len(s.Tickers) > 0 {
+		latest = s.Version
+	}
+	for _, op := range s.Ops {
+		if t := publishedAt(op.Ref, date); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// universeNames lists every universe or constituents history on disk.
+func universeNames() ([]string, error) {
+	seen := make(map[string]bool)
+	dirs, err := ioutil.ReadDir(universeDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if d.IsDir() {
+			seen[d.Name()] = true
+		}
+	}
+	files, err := ioutil.ReadDir("constituents")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".csv") && f.Name() != "delisted.csv" {
+			seen[strings.TrimSuffix(f.Name(), ".csv")] = true
+		}
+	}
+	names := []string{}
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func universeList(c *cli.Context) error {
+	names, err := universeNames()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range names {
+		m, err := loadMembership(name)
+		if err != nil {
+			return err
+		}
+		versions := []string{}
+		if u, ok := universes[name]; ok {
+			for _, s := range u.Snapshots {
+				versions = append(versions, s.Version.Format(dateLayout))
+			}
+		}
+		if _, ok := histories[name]; ok {
+			versions = append(versions, "history")
+		}
+		fmt.Printf("%-20s %5d members  %s\n", name, len(m.Members(now)), strings.Join(versions, ", "))
+	}
+	return nil
+}
+
+// membersOf resolves a NAME[@DATE] argument, defaulting to today.
+func membersOf(ref string) ([]string, error) {
+	name, date := splitRef(ref)
+	if date.IsZero() {
+		date = time.Now()
+	}
+	m, err := loadMembership(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.Members(date), nil
+}
+
+func universeShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: universe show NAME[@DATE]")
+	}
+	members, err := membersOf(c.Args().First())
+	if err != nil {
+		return err
+	}
+	for _, ticker := range members {
+		fmt.Println(ticker)
+	}
+	return nil
+}
+
+func universeDiff(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("usage: universe diff NAME[@DATE] NAME[@DATE]")
+	}
+	a, err := membersOf(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	b, err := membersOf(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	inA := make(map[string]bool)
+	for _, ticker := range a {
+		inA[ticker] = true
+	}
+	inB := make(map[string]bool)
+	for _, ticker := range b {
+		inB[ticker] = true
+		if !inA[ticker] {
+			fmt.Println("+", ticker)
+		}
+	}
+	for _, ticker := range a {
+		if !inB[ticker] {
+			fmt.Println("-", ticker)
+		}
+	}
+	return nil
+}
+
+func universeImport(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("usage: universe import NAME FILE")
+	}
+	name, path := c.Args().Get(0), c.Args().Get(1)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	column := -1
+	seen := make(map[string]bool)
+	tickers := []string{}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if column < 0 {
+			column = 0
+			header := false
+			for i, field := range row {
+				field = strings.ToLower(strings.TrimSpace(field))
+				if field == c.String("column") || (c.String("column") == "" && (field == "ticker" || field == "symbol")) {
+					column, header = i, true
+					break
+				}
+			}
+			if header {
+				continue
+			}
+			if c.String("column") != "" {
+				return fmt.Errorf("%s: no column %q", path, c.String("column"))
+			}
+		}
+		if column >= len(row) {
+			continue
+		}
+		ticker := strings.ToUpper(strings.TrimSpace(row[column]))
+		if ticker != "" && !seen[ticker] {
+			seen[ticker] = true
+			tickers = append(tickers, ticker)
+		}
+	}
+	sort.Strings(tickers)
+	lines := []string{fmt.Sprintf("# imported from %s", filepath.Base(path))}
+	lines = append(lines, tickers...)
+	return writeSnapshot(name, c.String("date"), lines)
+}
+
+// universeCombine defines NAME from the universes given, using first for the
+// first universe and rest for the others.
+func universeCombine(first, rest string) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() < 2 {
+			return fmt.Errorf("usage: universe %s NAME UNIVERSE...", c.Command.Name)
+		}
+		name := c.Args().First()
+		lines := []string{}
+		for i, ref := range c.Args().Tail() {
+			membershipMu.Lock()
+			err := loadUniverseClosure(ref, map[string]bool{name: true})
+			membershipMu.Unlock()
+			if err != nil {
+				return err
+			}
+			kind := rest
+			if i == 0 {
+				kind = first
+			}
+			lines = append(lines, kind+" "+ref)
+		}
+		return writeSnapshot(name, c.String("date"), lines)
+	}
+}
+
+func writeSnapshot(name, date string, lines []string) error {
+	if strings.ContainsAny(name, "@/ ") || name == "" {
+		return fmt.Errorf("invalid universe name %q", name)
+	}
+	if date == "" {
+		date = dateKey(time.Now())
+	}
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		return err
+	}
+	dir := filepath.Join(universeDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, date+".txt")
+	err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err == nil {
+		fmt.Println("wrote", path)
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testSnapshot(t *testing.T, version string, tickers string, ops ...universeOp) snapshot {
+	t.Helper()
+	s := snapshot{Version: day(t, version), Tickers: make(map[string]bool), Ops: ops}
+	for _, ticker := range strings.Fields(tickers) {
+		s.Tickers[ticker] = true
+	}
+	return s
+}
+
+func TestUniverseMembers(t *testing.T) {
+	defer func(saved map[string]*universe) { universes = saved }(universes)
+	universes = map[string]*universe{
+		"a": {Name: "a", Snapshots: []snapshot{
+			testSnapshot(t, "2018-01-01", "AAA BBB CCC"),
+			testSnapshot(t, "2019-01-01", "AAA BBB DDD"),
+		}},
+		"b": {Name: "b", Snapshots: []snapshot{testSnapshot(t, "2018-01-01", "BBB CCC")}},
+		"minus": {Name: "minus", Snapshots: []snapshot{
+			testSnapshot(t, "2018-01-01", "ZZZ", universeOp{"include", "a"}, universeOp{"exclude", "b"}),
+		}},
+		"both": {Name: "both", Snapshots: []snapshot{
+			testSnapshot(t, "2018-01-01", "", universeOp{"include", "a"}, universeOp{"intersect", "b"}),
+		}},
+		"pinned": {Name: "pinned", Snapshots: []snapshot{
+			testSnapshot(t, "2018-01-01", "", universeOp{"include", "a@2018-06-01"}),
+		}},
+	}
+	for _, c := range []struct {
+		name, date string
+		want       []string
+	}{
+		{"a", "2017-06-01", []string{"AAA", "BBB", "CCC"}}, // before the first snapshot
+		{"a", "2018-06-01", []string{"AAA", "BBB", "CCC"}},
+		{"a", "2019-01-01", []string{"AAA", "BBB", "DDD"}},
+		{"minus", "2018-06-01", []string{"AAA", "ZZZ"}},
+		{"minus", "2019-06-01", []string{"AAA", "DDD", "ZZZ"}},
+		{"both", "2018-06-01", []string{"BBB", "CCC"}},
+		{"both", "2019-06-01", []string{"BBB"}},
+		{"pinned", "2019-06-01", []string{"AAA", "BBB", "CCC"}},
+	} {
+		got := (&Membership{Name: c.name}).Members(day(t, c.date))
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s on %s: %v, want %v", c.name, c.date, got, c.want)
+		}
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "2018-06-01.txt")
+	text := "AAA\nBBB # comment\n\ninclude sp500@2018-06-01\nexclude sector:Financial Services\nintersect b\n"
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := readSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Tickers, map[string]bool{"AAA": true, "BBB": true}) {
+		t.Errorf("tickers %v", s.Tickers)
+	}
+	want := []universeOp{{"include", "sp500@2018-06-01"}, {"exclude", "sector:Financial Services"}, {"intersect", "b"}}
+	if !reflect.DeepEqual(s.Ops, want) {
+		t.Errorf("ops %v, want %v", s.Ops, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("AAA BBB\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSnapshot(path); err == nil {
+		t.Errorf("read %q without an error", "AAA BBB")
+	}
+}
+
+func TestSplitRef(t *testing.T) {
+	name, date := splitRef("sp500@2018-06-01")
+	if name != "sp500" || dateKey(date) != "2018-06-01" {
+		t.Errorf("splitRef = %s, %v", name, date)
+	}
+	if name, date := splitRef("sp500"); name != "sp500" || !date.IsZero() {
+		t.Errorf("splitRef = %s, %v", name, date)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Walk-forward validation: the parameters are picked on an in-sample window,
+// traded on the out-of-sample window that follows it, and the window rolls
+// forward by the out-of-sample length. Only the out-of-sample trading counts,
+// carried in one account from window to window.
+
+var walkforwardFlags = []cli.Flag{
+	cli.StringFlag{Name: "strategy", Usage: "strategy to take the other parameters from (default the first)"},
+	cli.StringFlag{Name: "thresholds", Value: "0.04,0.045,0.049,0.05,0.055,0.06", Usage: "ThresholdPct values to try"},
+	cli.StringFlag{Name: "increments", Value: "2000,2500,3000,4000,5000", Usage: "Increment values to try"},
+	cli.IntFlag{Name: "years", Value: 12, Usage: "years of history to walk through"},
+	cli.IntFlag{Name: "in-sample", Value: 3, Usage: "in-sample window in years"},
+	cli.IntFlag{Name: "out-of-sample", Value: 12, Usage: "out-of-sample window in months"},
+}
+
+func walkforward(c *cli.Context) error {
+	base, err := findStrategy(c.String("strategy"))
+	if err != nil {
+		return err
+	}
+	thresholds, err := parseFloats(c.String("thresholds"))
+	if err != nil {
+		return err
+	}
+	increments, err := parseFloats(c.String("increments"))
+	if err != nil {
+		return err
+	}
+	if c.Int("in-sample") <= 0 || c.Int("out-of-sample") <= 0 {
+		return fmt.Errorf("window lengths must be positive")
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	now := time.Now()
+	start := yearsAgo(c.Int("years"))
+	windows := walkWindows(start, now, c.Int("in-sample"), c.Int("out-of-sample"))
+	if len(windows) == 0 {
+		return fmt.Errorf("history of %d years is too short for a %d year in-sample window", c.Int("years"), c.Int("in-sample"))
+	}
+	acct := newAccount(base.StartCash)
+	fmt.Printf("walking forward %s:\n", base.Name)
+	for _, w := range windows {
+		best, bestTotal, err := optimize(ctx, base, thresholds, increments, w.Start, w.Split)
+		if err != nil {
+			return err
+		}
+		before, err := equity(ctx, acct, PreviousSession(w.Split))
+		if err != nil {
+			return err
+		}
+		if err := backtest(ctx, best, acct, w.Split, w.End, nil); err != nil {
+			return err
+		}
+		after, err := equity(ctx, acct, PreviousSession(w.End))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  in %s..%s: %.3f%% thresh, %.0f increment (%.2f%%/yr)  out %s..%s: %+.2f%%\n",
+			w.Start.Format(dateLayout), w.Split.Format(dateLayout),
+			best.ThresholdPct*100, best.Increment,
+			cagr(base.StartCash, bestTotal, float64(c.Int("in-sample")))*100,
+			w.Split.Format(dateLayout), w.End.Format(dateLayout),
+			(after/before-1)*100)
+	}
+	oosStart, oosEnd := windows[0].Split, windows[len(windows)-1].End
+	total, err := equity(ctx, acct, PreviousSession(oosEnd))
+	if err != nil {
+		return err
+	}
+	years := oosEnd.Sub(oosStart).Hours() / 24 / 365.25
+	fmt.Printf("out-of-sample %s..%s --> %f  (%f%%)\n", oosStart.Format(dateLayout), oosEnd.Format(dateLayout), total, cagr(base.StartCash, total, years)*100)
+	return nil
+}
+
+// walkWindow picks the parameters on Start..Split and trades them on
+// Split..End.
+type walkWindow struct {
+	Start, Split, End time.Time
+}
+
+// walkWindows rolls an in-sample window of inSample years followed by
+// outOfSample months forward from start by outOfSample months for as long as
+// the in-sample part ends before now, cutting the last one short at now.
+func walkWindows(start, now time.Time, inSample, outOfSample int) []walkWindow {
+	windows := []walkWindow{}
+	for isStart := start; ; isStart = isStart.AddDate(0, outOfSample, 0) {
+		isEnd := isStart.AddDate(inSample, 0, 0)
+		if !isEnd.Before(now) {
+			break
+		}
+		end := isEnd.AddDate(0, outOfSample, 0)
+		if end.After(now) {
+			end = now
+		}
+		windows = append(windows, walkWindow{isStart, isEnd, end})
+	}
+	return windows
+}
+
+// optimize backtests every ThresholdPct/Increment pair on the window in one
+// pass and returns the one ending with the most money.
+func optimize(ctx context.Context, base Strategy, thresholds, increments []float64, start, end time.Time) (Strategy, float64, error) {
+	runners := []*runner{}
+	for _, threshold := range thresholds {
+		for _, increment := range increments {
+			s := base
+			s.ThresholdPct = threshold
+			s.Increment = increment
+			runners = append(runners, newRunner(ctx, s, newAccount(s.StartCash), start, nil))
+		}
+	}
+	if err := pass(ctx, runners, start, end); err != nil {
+		return Strategy{}, 0, err
+	}
+	var best Strategy
+	bestTotal := -1.0
+	for _, r := range runners {
+		total, err := 0.0, r.Err
+		if err == nil {
+			total, err = equity(ctx, r.Account, PreviousSession(end))
+		}
+		if err != nil {
+			return Strategy{}, 0, fmt.Errorf("%.3f%% thresh, %.0f increment: %v", r.Strategy.ThresholdPct*100, r.Strategy.Increment, err)
+		}
+		if total > bestTotal {
+			best, bestTotal = r.Strategy, total
+		}
+	}
+	return best, bestTotal, nil
+}
+
+// equity is the cash plus the positions valued on date.
+func equity(ctx context.Context, acct *Account, date time.Time) (float64, error) {
+	values, err := holdingValues(ctx, acct, date)
+	if err != nil {
+		return 0, err
+	}
+	return calculateTotal(acct.Cash, values), nil
+}
+
+func parseFloats(list string) ([]float64, error) {
+	values := []float64{}
+	for _, field := range strings.Split(list, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
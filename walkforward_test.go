@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWalkWindows(t *testing.T) {
+	for _, c := range []struct {
+		start, now        string
+		inSample, outMons int
+		want              [][3]string
+	}{
+		{"2010-01-04", "2014-06-02", 3, 12, [][3]string{
+			{"2010-01-04", "2013-01-04", "2014-01-04"},
+			{"2011-01-04", "2014-01-04", "2014-06-02"}, // cut short
+		}},
+		{"2010-01-04", "2013-01-04", 3, 12, [][3]string{}}, // in-sample reaches now
+		{"2010-01-04", "2011-03-01", 1, 1, [][3]string{
+			{"2010-01-04", "2011-01-04", "2011-02-04"},
+			{"2010-02-04", "2011-02-04", "2011-03-01"},
+		}},
+	} {
+		got := [][3]string{}
+		for _, w := range walkWindows(day(t, c.start), day(t, c.now), c.inSample, c.outMons) {
+			got = append(got, [3]string{dateKey(w.Start), dateKey(w.Split), dateKey(w.End)})
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("walkWindows(%s, %s, %d, %d) = %v, want %v", c.start, c.now, c.inSample, c.outMons, got, c.want)
+		}
+	}
+}
+
+func TestParseFloats(t *testing.T) {
+	got, err := parseFloats("0.04, 0.045,5000")
+	if err != nil || !reflect.DeepEqual(got, []float64{0.04, 0.045, 5000}) {
+		t.Errorf("parseFloats = %v, %v", got, err)
+	}
+	if _, err := parseFloats("0.04,,0.05"); err == nil {
+		t.Errorf("parseFloats accepted an empty value")
+	}
+}